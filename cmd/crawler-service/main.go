@@ -1,20 +1,28 @@
 package main
 
 import (
-	"crypto/tls"
+	"context"
+	"errors"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"github.com/elastic/go-elasticsearch/v8"
 	"github.com/gin-gonic/gin"
 
+	"recommand/internal/blob"
 	"recommand/internal/config"
+	"recommand/internal/content"
 	"recommand/internal/crawler"
 	"recommand/internal/db"
 	chttp "recommand/internal/http"
 	"recommand/internal/http/handlers"
 	"recommand/internal/kafka"
 	"recommand/internal/repository"
+	"recommand/internal/scheduler"
+	"recommand/internal/search"
 )
 
 func main() {
@@ -22,48 +30,82 @@ func main() {
 	if err := config.Load(&cfg); err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := content.SetTimezone(cfg.Content.Timezone); err != nil {
+		log.Fatalf("invalid CONTENT_TIMEZONE %q: %v", cfg.Content.Timezone, err)
+	}
 
 	logger := log.Default()
 
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	pgDB, err := db.NewPostgres(cfg.Database)
 	if err != nil {
 		logger.Fatalf("failed to connect postgres: %v", err)
 	}
 	defer pgDB.Close()
 
-	kafkaWriter, err := kafka.NewWriter(cfg.Kafka)
+	sourceRepo := repository.NewSourceRepo(pgDB)
+	taskRepo := repository.NewTaskRepo(pgDB)
+	frontierRepo := repository.NewFrontierRepo(pgDB)
+
+	// 异步写入时，文章在投递回调里才记为完成或失败
+	kafkaWriter, err := kafka.NewWriter(cfg.Kafka, crawler.RawDelivered(frontierRepo, taskRepo, logger))
 	if err != nil {
 		logger.Fatalf("failed to create kafka writer: %v", err)
 	}
-	defer kafkaWriter.Close()
-
-	// ES client for search (dev only: skip TLS verification for local self-signed cert)
-	esClient, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{cfg.ES.Address},
-		Username:  cfg.ES.Username,
-		Password:  cfg.ES.Password,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	})
+
+	// ES client for search
+	esClient, err := search.NewClient(cfg.ES)
 	if err != nil {
 		logger.Fatalf("failed to create ES client: %v", err)
 	}
 
 	r := gin.Default()
 
-	sourceRepo := repository.NewSourceRepo(pgDB)
-	taskRepo := repository.NewTaskRepo(pgDB)
 	sourceHandler := handlers.NewSourceHandler(sourceRepo)
-	engine := crawler.NewEngine(taskRepo, sourceRepo, kafkaWriter, logger)
+	blobStore, err := blob.Open(cfg.Blob)
+	if err != nil {
+		logger.Fatalf("failed to open blob store: %v", err)
+	}
+	httpCacheRepo := repository.NewHTTPCacheRepo(pgDB)
+	fetcher := crawler.NewFetcher(cfg.Crawler, httpCacheRepo, logger)
+	newsRepo := repository.NewNewsRepo(pgDB)
+	engine := crawler.NewEngine(taskRepo, sourceRepo, newsRepo, frontierRepo, kafkaWriter, fetcher, blobStore, blob.Options(cfg.Blob), cfg.Crawler, logger)
+	// 重启后接管心跳超时的 pending/running 任务，从抓取队列的检查点继续
+	go engine.AdoptOrphans(ctx)
 	taskHandler := handlers.NewTaskHandler(sourceRepo, taskRepo, engine)
+	// 让 /parsers 接口也能列出 news_sources 中配置的抽取规则
+	go content.DefaultRegistry.WatchSourceRules(ctx, sourceRepo.List, cfg.Content.RulesRefreshInterval, logger)
+	parserHandler := handlers.NewParserHandler(content.DefaultRegistry)
 	searchHandler := handlers.NewSearchHandler(esClient, cfg.ES.Index)
 
-	chttp.RegisterRoutes(r, sourceHandler, taskHandler, searchHandler)
+	chttp.RegisterRoutes(r, sourceHandler, taskHandler, parserHandler, searchHandler)
 
-	addr := cfg.HTTP.ListenAddr
-	logger.Printf("crawler-service listening on %s", addr)
-	if err := http.ListenAndServe(addr, r); err != nil {
-		logger.Fatalf("http server stopped: %v", err)
+	if cfg.Scheduler.Enabled {
+		sched := scheduler.New(cfg.Scheduler, sourceRepo, taskRepo, engine, logger)
+		go sched.Run(ctx)
+	}
+
+	srv := &http.Server{Addr: cfg.HTTP.ListenAddr, Handler: r}
+	go func() {
+		logger.Printf("crawler-service listening on %s", srv.Addr)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Fatalf("http server stopped: %v", err)
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Printf("crawler-service shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		logger.Printf("http server shutdown: %v", err)
+	}
+	// 先停下正在运行的任务（保持 running，之后从检查点接管），再关闭 writer：
+	// Close 会把缓冲中的消息发出去并等待投递回调执行完
+	engine.Shutdown()
+	if err := kafkaWriter.Close(); err != nil {
+		logger.Printf("close kafka writer: %v", err)
 	}
 }
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"recommand/internal/config"
+	ikafka "recommand/internal/kafka"
+)
+
+// filter selects the dead-letter messages to replay; empty fields match everything.
+type filter struct {
+	source string
+	errSub string
+	stage  string
+}
+
+func (f filter) match(m kafka.Message) bool {
+	if f.stage != "" && ikafka.Header(m, ikafka.HeaderDLQStage) != f.stage {
+		return false
+	}
+	if f.errSub != "" && !strings.Contains(ikafka.Header(m, ikafka.HeaderDLQError), f.errSub) {
+		return false
+	}
+	if f.source != "" {
+		// news.raw 和 news.parsed 的消息都带 source_code
+		var v struct {
+			SourceCode string `json:"source_code"`
+		}
+		if err := json.Unmarshal(m.Value, &v); err != nil || v.SourceCode != f.source {
+			return false
+		}
+	}
+	return true
+}
+
+func main() {
+	var cfg config.Config
+	if err := config.Load(&cfg); err != nil {
+		log.Fatalf("failed to load config: %v", err)
+	}
+
+	topic := flag.String("topic", cfg.Kafka.TopicRawDLQ, "dead-letter topic to replay")
+	var f filter
+	flag.StringVar(&f.source, "source", "", "only replay messages of this source_code")
+	flag.StringVar(&f.errSub, "error", "", "only replay messages whose error contains this text")
+	flag.StringVar(&f.stage, "stage", "", "only replay messages that failed in this stage (parsed-producer, news-sink)")
+	limit := flag.Int("limit", 0, "replay at most this many messages (0: no limit)")
+	dryRun := flag.Bool("dry-run", false, "only list the matching messages")
+	flag.Parse()
+
+	brokers := cfg.Kafka.Brokers
+	if len(brokers) == 0 {
+		brokers = []string{"localhost:9092"}
+	}
+
+	dialer, err := ikafka.Dialer(cfg.Kafka)
+	if err != nil {
+		log.Fatalf("invalid kafka config: %v", err)
+	}
+	transport, err := ikafka.Transport(cfg.Kafka)
+	if err != nil {
+		log.Fatalf("invalid kafka config: %v", err)
+	}
+
+	ctx := context.Background()
+	conn, err := dialer.DialContext(ctx, "tcp", brokers[0])
+	if err != nil {
+		log.Fatalf("failed to connect kafka: %v", err)
+	}
+	partitions, err := conn.ReadPartitions(*topic)
+	conn.Close()
+	if err != nil {
+		log.Fatalf("failed to read partitions of %s: %v", *topic, err)
+	}
+
+	// 逐条同步重放，BatchSize 为 1 时每条消息不用等 BatchTimeout
+	writer := &kafka.Writer{
+		Addr:         kafka.TCP(brokers...),
+		Balancer:     &kafka.Hash{},
+		BatchSize:    1,
+		RequiredAcks: kafka.RequireAll,
+		Transport:    transport,
+	}
+	defer writer.Close()
+
+	// 死信主题不提交 offset：每次从头扫描到启动时的末尾，按条件挑出要重放的消息
+	var scanned, replayed int
+	for _, p := range partitions {
+		n, m, err := replayPartition(ctx, dialer, brokers, *topic, p.ID, f, *limit-replayed, *dryRun, writer)
+		scanned += n
+		replayed += m
+		if err != nil {
+			log.Fatalf("replay %s partition=%d: %v", *topic, p.ID, err)
+		}
+		if *limit > 0 && replayed >= *limit {
+			break
+		}
+	}
+	if *dryRun {
+		log.Printf("dlq-replay: %d of %d messages in %s match", replayed, scanned, *topic)
+		return
+	}
+	log.Printf("dlq-replay: replayed %d of %d messages in %s", replayed, scanned, *topic)
+}
+
+// replayPartition replays the matching messages of one partition, up to the end the partition
+// had when it was opened, and returns the number of scanned and replayed (or matched) messages.
+// limit <= 0 means no limit.
+func replayPartition(ctx context.Context, dialer *kafka.Dialer, brokers []string, topic string, partition int, f filter, limit int, dryRun bool, writer *kafka.Writer) (scanned, replayed int, err error) {
+	conn, err := dialer.DialLeader(ctx, "tcp", brokers[0], topic, partition)
+	if err != nil {
+		return 0, 0, err
+	}
+	first, last, err := conn.ReadOffsets()
+	conn.Close()
+	if err != nil || first >= last {
+		return 0, 0, err
+	}
+
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:   brokers,
+		Dialer:    dialer,
+		Topic:     topic,
+		Partition: partition,
+		MinBytes:  1,
+		MaxBytes:  10e6,
+	})
+	defer reader.Close()
+	if err := reader.SetOffset(first); err != nil {
+		return 0, 0, err
+	}
+
+	for {
+		if limit > 0 && replayed >= limit {
+			return scanned, replayed, nil
+		}
+		rctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+		m, err := reader.ReadMessage(rctx)
+		cancel()
+		if err != nil {
+			return scanned, replayed, err
+		}
+		scanned++
+
+		if f.match(m) {
+			out, ok := ikafka.Replay(m)
+			switch {
+			case !ok:
+				log.Printf("skip partition=%d offset=%d: no %s header", m.Partition, m.Offset, ikafka.HeaderDLQTopic)
+			case dryRun:
+				log.Printf("match partition=%d offset=%d topic=%s stage=%s failed_at=%s error=%s", m.Partition, m.Offset, out.Topic, ikafka.Header(m, ikafka.HeaderDLQStage), ikafka.Header(m, ikafka.HeaderDLQFailedAt), ikafka.Header(m, ikafka.HeaderDLQError))
+				replayed++
+			default:
+				if err := writer.WriteMessages(ctx, out); err != nil {
+					return scanned, replayed, err
+				}
+				replayed++
+			}
+		}
+		if m.Offset >= last-1 {
+			return scanned, replayed, nil
+		}
+	}
+}
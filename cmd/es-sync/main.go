@@ -3,30 +3,41 @@ package main
 import (
 	"bytes"
 	"context"
-	"crypto/tls"
 	"database/sql"
 	"encoding/json"
+	"fmt"
 	"io"
 	"log"
-	"net/http"
 	"time"
 
 	"github.com/elastic/go-elasticsearch/v8"
+	"github.com/lib/pq"
 
 	"recommand/internal/config"
 	"recommand/internal/db"
+	"recommand/internal/repository"
+	"recommand/internal/search"
 )
 
 type NewsRow struct {
-	ID          string
-	Hash        sql.NullString
-	SourceCode  string
-	URL         string
-	Title       string
-	Content     string
-	PublishTime sql.NullTime
-	CrawlTime   time.Time
-	UpdatedAt   time.Time
+	ID           string
+	Hash         sql.NullString
+	SourceCode   string
+	URL          string
+	Title        string
+	Content      string
+	Author       sql.NullString
+	Editor       sql.NullString
+	OriginSource sql.NullString
+	Summary      sql.NullString
+	CanonicalURL sql.NullString
+	LeadImage    sql.NullString
+	Images       []string
+	Tags         []string
+	Language     sql.NullString
+	PublishTime  sql.NullTime
+	CrawlTime    time.Time
+	UpdatedAt    time.Time
 }
 
 func main() {
@@ -42,15 +53,8 @@ func main() {
 	}
 	defer sqldb.Close()
 
-	// ES client (dev only: skip TLS verification for local self-signed cert)
-	es, err := elasticsearch.NewClient(elasticsearch.Config{
-		Addresses: []string{cfg.ES.Address},
-		Username:  cfg.ES.Username,
-		Password:  cfg.ES.Password,
-		Transport: &http.Transport{
-			TLSClientConfig: &tls.Config{InsecureSkipVerify: true},
-		},
-	})
+	// ES client
+	es, err := search.NewClient(cfg.ES)
 	if err != nil {
 		log.Fatalf("failed to create ES client: %v", err)
 	}
@@ -58,12 +62,27 @@ func main() {
 	log.Printf("es-sync started: db=%s es=%s index=%s", cfg.Database.DSN, cfg.ES.Address, cfg.ES.Index)
 
 	ctx := context.Background()
-	lastSync := time.Time{}
 
+	// 检查点按索引名保存在 es_sync_checkpoint，重启后从上次确认写入的位置继续
+	checkpoints := repository.NewSyncCheckpointRepo(sqldb)
+	var (
+		lastUpdated time.Time
+		lastID      string
+	)
 	for {
-		rows, err := fetchNewsSince(ctx, sqldb, lastSync)
+		lastUpdated, lastID, err = checkpoints.Get(ctx, cfg.ES.Index)
+		if err == nil {
+			break
+		}
+		log.Printf("load checkpoint error: %v", err)
+		time.Sleep(5 * time.Second)
+	}
+	log.Printf("es-sync resuming after updated_at=%s id=%s", lastUpdated.Format(time.RFC3339Nano), lastID)
+
+	for {
+		rows, err := fetchNewsAfter(ctx, sqldb, lastUpdated, lastID)
 		if err != nil {
-			log.Printf("fetchNewsSince error: %v", err)
+			log.Printf("fetchNewsAfter error: %v", err)
 			time.Sleep(5 * time.Second)
 			continue
 		}
@@ -72,27 +91,35 @@ func main() {
 			continue
 		}
 
-		if err := bulkIndexNews(ctx, es, cfg.ES.Index, rows); err != nil {
+		// 只推进到 ES 确认写入的连续前缀，之后的行下一轮重新同步
+		indexed, err := bulkIndexNews(ctx, es, cfg.ES.Index, rows)
+		if err != nil {
 			log.Printf("bulkIndexNews error: %v", err)
 		}
-
-		for _, r := range rows {
-			if r.UpdatedAt.After(lastSync) {
-				lastSync = r.UpdatedAt
+		if indexed > 0 {
+			last := rows[indexed-1]
+			lastUpdated, lastID = last.UpdatedAt, last.ID
+			if err := checkpoints.Save(ctx, cfg.ES.Index, lastUpdated, lastID); err != nil {
+				// 内存中的检查点照常推进；重启后最多重复写入已同步的文档
+				log.Printf("save checkpoint error: %v", err)
 			}
 		}
+		if indexed < len(rows) {
+			time.Sleep(5 * time.Second)
+		}
 	}
 }
 
-func fetchNewsSince(ctx context.Context, db *sql.DB, since time.Time) ([]NewsRow, error) {
+// fetchNewsAfter returns the next page of news ordered by (updated_at, id), strictly after the given checkpoint.
+func fetchNewsAfter(ctx context.Context, db *sql.DB, updatedAt time.Time, id string) ([]NewsRow, error) {
 	const q = `
-SELECT id, hash, source_code, url, title, content, publish_time, crawl_time, updated_at
+SELECT id, hash, source_code, url, title, content, author, editor, origin_source, summary, canonical_url, lead_image, images, tags, language, publish_time, crawl_time, updated_at
 FROM news
-WHERE updated_at > $1
-ORDER BY updated_at ASC
+WHERE (updated_at, id) > ($1, $2)
+ORDER BY updated_at ASC, id ASC
 LIMIT 500
 `
-	rows, err := db.QueryContext(ctx, q, since)
+	rows, err := db.QueryContext(ctx, q, updatedAt, id)
 	if err != nil {
 		return nil, err
 	}
@@ -101,7 +128,7 @@ LIMIT 500
 	var result []NewsRow
 	for rows.Next() {
 		var r NewsRow
-		if err := rows.Scan(&r.ID, &r.Hash, &r.SourceCode, &r.URL, &r.Title, &r.Content, &r.PublishTime, &r.CrawlTime, &r.UpdatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.Hash, &r.SourceCode, &r.URL, &r.Title, &r.Content, &r.Author, &r.Editor, &r.OriginSource, &r.Summary, &r.CanonicalURL, &r.LeadImage, pq.Array(&r.Images), pq.Array(&r.Tags), &r.Language, &r.PublishTime, &r.CrawlTime, &r.UpdatedAt); err != nil {
 			return nil, err
 		}
 		result = append(result, r)
@@ -109,9 +136,23 @@ LIMIT 500
 	return result, rows.Err()
 }
 
-func bulkIndexNews(ctx context.Context, es *elasticsearch.Client, index string, rows []NewsRow) error {
+// bulkResponse is the part of the Bulk API response needed to tell which documents were written.
+type bulkResponse struct {
+	Errors bool `json:"errors"`
+	Items  []map[string]struct {
+		ID     string `json:"_id"`
+		Status int    `json:"status"`
+		Error  *struct {
+			Type   string `json:"type"`
+			Reason string `json:"reason"`
+		} `json:"error"`
+	} `json:"items"`
+}
+
+// bulkIndexNews indexes rows and returns how many leading rows Elasticsearch confirmed.
+func bulkIndexNews(ctx context.Context, es *elasticsearch.Client, index string, rows []NewsRow) (int, error) {
 	if len(rows) == 0 {
-		return nil
+		return 0, nil
 	}
 	var buf bytes.Buffer
 	enc := json.NewEncoder(&buf)
@@ -129,42 +170,66 @@ func bulkIndexNews(ctx context.Context, es *elasticsearch.Client, index string,
 			},
 		}
 		if err := enc.Encode(meta); err != nil {
-			return err
+			return 0, err
 		}
 
 		body := map[string]any{
-			"id":          r.ID,
-			"hash":        r.Hash.String,
-			"source_code": r.SourceCode,
-			"url":         r.URL,
-			"title":       r.Title,
-			"content":     r.Content,
-			"crawl_time":  r.CrawlTime,
-			"updated_at":  r.UpdatedAt,
+			"id":            r.ID,
+			"hash":          r.Hash.String,
+			"source_code":   r.SourceCode,
+			"url":           r.URL,
+			"title":         r.Title,
+			"content":       r.Content,
+			"author":        r.Author.String,
+			"editor":        r.Editor.String,
+			"origin_source": r.OriginSource.String,
+			"summary":       r.Summary.String,
+			"canonical_url": r.CanonicalURL.String,
+			"lead_image":    r.LeadImage.String,
+			"images":        r.Images,
+			"tags":          r.Tags,
+			"language":      r.Language.String,
+			"crawl_time":    r.CrawlTime,
+			"updated_at":    r.UpdatedAt,
 		}
 		if r.PublishTime.Valid {
 			body["publish_time"] = r.PublishTime.Time
 		}
 		if err := enc.Encode(body); err != nil {
-			return err
+			return 0, err
 		}
 	}
 
 	res, err := es.Bulk(bytes.NewReader(buf.Bytes()), es.Bulk.WithContext(ctx))
 	if err != nil {
-		// 部分环境下可能在读取响应时返回 EOF，这里记录 warning 但不中断主循环。
-		if err == io.EOF {
-			log.Printf("es bulk warning: EOF while reading response")
-			return nil
-		}
-		return err
+		// 包括读取响应时的 EOF：无法确认写入结果，整批下一轮重试
+		return 0, err
 	}
 	defer res.Body.Close()
 
 	if res.IsError() {
 		body, _ := io.ReadAll(res.Body)
-		log.Printf("es bulk error: status=%s body=%s", res.Status(), string(body))
+		return 0, fmt.Errorf("es bulk error: status=%s body=%s", res.Status(), string(body))
+	}
+
+	var br bulkResponse
+	if err := json.NewDecoder(res.Body).Decode(&br); err != nil {
+		return 0, fmt.Errorf("decode bulk response: %w", err)
+	}
+	if len(br.Items) != len(rows) {
+		return 0, fmt.Errorf("bulk response has %d items for %d documents", len(br.Items), len(rows))
 	}
 
-	return nil
+	// items 与请求中的文档一一对应、顺序一致
+	for i, item := range br.Items {
+		result, ok := item["index"]
+		if !ok || result.Status < 200 || result.Status >= 300 {
+			reason := "no index result"
+			if result.Error != nil {
+				reason = result.Error.Type + ": " + result.Error.Reason
+			}
+			return i, fmt.Errorf("news id=%s (_id=%s) not indexed: status=%d %s", rows[i].ID, result.ID, result.Status, reason)
+		}
+	}
+	return len(rows), nil
 }
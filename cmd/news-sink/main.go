@@ -3,31 +3,24 @@ package main
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
-	"time"
+	"os"
+	"os/signal"
+	"syscall"
 
-	_ "github.com/lib/pq"
+	"github.com/lib/pq"
 	"github.com/segmentio/kafka-go"
 
 	"recommand/internal/config"
 	"recommand/internal/db"
+	"recommand/internal/domain"
+	ikafka "recommand/internal/kafka"
+	"recommand/internal/pipeline"
+	"recommand/internal/repository"
 )
 
-// ParsedNews mirrors the message structure in news.parsed.
-type ParsedNews struct {
-	ID          string    `json:"id"`
-	TaskID      string    `json:"task_id"`
-	SourceID    int64     `json:"source_id"`
-	SourceCode  string    `json:"source_code"`
-	URL         string    `json:"url"`
-	Title       string    `json:"title"`
-	Content     string    `json:"content"`
-	PublishTime time.Time `json:"publish_time"`
-	CrawlTime   time.Time `json:"crawl_time"`
-	Hash        string    `json:"hash"`
-}
-
 func main() {
 	var cfg config.Config
 	if err := config.Load(&cfg); err != nil {
@@ -41,63 +34,111 @@ func main() {
 	}
 	defer sqldb.Close()
 
-	// Kafka reader on news.parsed（简单分区读取，从最早 offset 开始，方便本地调试）
-	brokers := cfg.Kafka.Brokers
-	if len(brokers) == 0 {
-		brokers = []string{"localhost:9092"}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	frontierRepo := repository.NewFrontierRepo(sqldb)
+	taskRepo := repository.NewTaskRepo(sqldb)
+	// recordOutcome 把入库结果回写到任务的抓取队列和计数器上，最后一条消息有结果后任务才算完成
+	recordOutcome := func(ctx context.Context, taskID, url, outcome string) {
+		if taskID == "" {
+			return
+		}
+		recorded, err := frontierRepo.RecordOutcome(ctx, taskID, url, outcome)
+		if err != nil {
+			log.Printf("record outcome of task=%s url=%s: %v", taskID, url, err)
+		}
+		if recorded {
+			if _, err := taskRepo.CompleteIfSettled(ctx, taskID); err != nil {
+				log.Printf("complete task=%s: %v", taskID, err)
+			}
+		}
 	}
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     brokers,
-		Topic:       cfg.Kafka.TopicParsed,
-		Partition:   0,
-		StartOffset: kafka.FirstOffset,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-	})
-	defer reader.Close()
+	// Kafka consumer on news.parsed as a member of the news-sink group; failures go to news.parsed.dlq
+	// and count as failed articles of their task
+	consumer, err := ikafka.NewConsumer(cfg.Kafka, cfg.Kafka.TopicParsed, cfg.Kafka.TopicParsedDLQ, "news-sink", func(ctx context.Context, m kafka.Message, err error) {
+		if n, derr := pipeline.DecodeParsed(m.Value); derr == nil {
+			recordOutcome(ctx, n.TaskID, n.URL, domain.OutcomeSinkFailed)
+		}
+	}, log.Default())
+	if err != nil {
+		log.Fatalf("failed to create kafka consumer: %v", err)
+	}
+	defer consumer.Close()
 
 	log.Printf("news-sink consuming from %s and writing to Postgres", cfg.Kafka.TopicParsed)
 
-	ctx := context.Background()
-	for {
-		m, err := reader.ReadMessage(ctx)
+	// 写库失败返回错误由 consumer 重试；upsert 按 id 幂等，重复投递和重放不会产生重复数据
+	err = consumer.Run(ctx, func(ctx context.Context, m kafka.Message) error {
+		n, err := pipeline.DecodeParsed(m.Value)
 		if err != nil {
-			log.Printf("read error from parsed: %v", err)
-			time.Sleep(time.Second)
-			continue
+			return ikafka.Permanent(fmt.Errorf("decode parsed: %w", err))
 		}
 
-		var n ParsedNews
-		if err := json.Unmarshal(m.Value, &n); err != nil {
-			log.Printf("decode parsed error at offset=%d: %v", m.Offset, err)
-			continue
+		inserted, err := upsertNews(ctx, sqldb, n)
+		if err != nil {
+			return fmt.Errorf("upsert news id=%s url=%s: %w", n.ID, n.URL, err)
 		}
 
-		if err := upsertNews(ctx, sqldb, &n); err != nil {
-			log.Printf("upsert news error id=%s url=%s: %v", n.ID, n.URL, err)
-			continue
+		outcome := domain.OutcomeSaved
+		if !inserted {
+			outcome = domain.OutcomeDuplicate
 		}
+		recordOutcome(ctx, n.TaskID, n.URL, outcome)
+
+		log.Printf("news-sink: upserted news id=%s url=%s outcome=%s", n.ID, n.URL, outcome)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("consume %s: %v", cfg.Kafka.TopicParsed, err)
+	}
+}
 
-		log.Printf("news-sink: upserted news id=%s url=%s", n.ID, n.URL)
+// upsertNews writes n into news and reports whether it was inserted (false: the news was
+// already stored and was updated).
+//
+// The id (task::url) is the primary key, so a redelivered or replayed message updates its
+// row even when its hash changed, e.g. after a relative publish time like "3小时前" was
+// recomputed or a parser was fixed. When another row already has the hash (the same article
+// crawled by another task), that row is updated instead.
+func upsertNews(ctx context.Context, db *sql.DB, n *pipeline.ParsedNews) (inserted bool, err error) {
+	inserted, err = upsertNewsOn(ctx, db, "id", n)
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "uk_news_hash" {
+		return upsertNewsOn(ctx, db, "hash", n)
 	}
+	return inserted, err
 }
 
-func upsertNews(ctx context.Context, db *sql.DB, n *ParsedNews) error {
-	// 使用 hash 作为幂等键进行 UPSERT，按 hash 去重。
-	const q = `
+// upsertNewsOn inserts n, or updates the row that conflicts with it on column (id or hash).
+func upsertNewsOn(ctx context.Context, db *sql.DB, column string, n *pipeline.ParsedNews) (inserted bool, err error) {
+	// xmax=0 表示本次是插入而不是更新
+	q := `
 INSERT INTO news (
-	id, hash, task_id, source_id, source_code, url, title, content, publish_time, crawl_time, created_at, updated_at
+	id, hash, task_id, source_id, source_code, url, title, content, publish_time, crawl_time,
+	author, editor, origin_source, summary, canonical_url, lead_image, images, tags, language, created_at, updated_at
 ) VALUES (
-	$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, now(), now()
-) ON CONFLICT (hash) DO UPDATE SET
+	$1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, now(), now()
+) ON CONFLICT (` + column + `) DO UPDATE SET
+	hash = EXCLUDED.hash,
 	title = EXCLUDED.title,
 	content = EXCLUDED.content,
+	author = EXCLUDED.author,
+	editor = EXCLUDED.editor,
+	origin_source = EXCLUDED.origin_source,
+	summary = EXCLUDED.summary,
+	canonical_url = EXCLUDED.canonical_url,
+	lead_image = EXCLUDED.lead_image,
+	images = EXCLUDED.images,
+	tags = EXCLUDED.tags,
+	language = EXCLUDED.language,
 	publish_time = EXCLUDED.publish_time,
 	crawl_time = EXCLUDED.crawl_time,
-	updated_at = now();
+	updated_at = now()
+RETURNING (xmax = 0);
 `
-	_, err := db.ExecContext(ctx, q,
+	err = db.QueryRowContext(ctx, q,
 		n.ID,
 		n.Hash,
 		n.TaskID,
@@ -108,6 +149,15 @@ INSERT INTO news (
 		n.Content,
 		n.PublishTime,
 		n.CrawlTime,
-	)
-	return err
+		n.Author,
+		n.Editor,
+		n.OriginSource,
+		n.Summary,
+		n.CanonicalURL,
+		n.LeadImage,
+		pq.Array(n.Images),
+		pq.Array(n.Tags),
+		n.Language,
+	).Scan(&inserted)
+	return inserted, err
 }
@@ -5,64 +5,89 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
+	"recommand/internal/blob"
 	"recommand/internal/config"
 	"recommand/internal/content"
+	"recommand/internal/db"
+	"recommand/internal/domain"
 	ikafka "recommand/internal/kafka"
+	"recommand/internal/pipeline"
+	"recommand/internal/repository"
 )
 
-// RawMessage is the payload written by crawler Engine into news.raw.
-type RawMessage struct {
-	TaskID      string `json:"task_id"`
-	SourceID    int64  `json:"source_id"`
-	SourceCode  string `json:"source_code"`
-	URL         string `json:"url"`
-	StatusCode  int    `json:"status_code"`
-	BodySnippet string `json:"body_snippet"`
-}
-
-// ParsedNews is the structured news we will write into news.parsed.
-type ParsedNews struct {
-	ID          string    `json:"id"`
-	TaskID      string    `json:"task_id"`
-	SourceID    int64     `json:"source_id"`
-	SourceCode  string    `json:"source_code"`
-	URL         string    `json:"url"`
-	Title       string    `json:"title"`
-	Content     string    `json:"content"`
-	PublishTime time.Time `json:"publish_time"`
-	CrawlTime   time.Time `json:"crawl_time"`
-	Hash        string    `json:"hash"`
-}
-
 func main() {
 	var cfg config.Config
 	if err := config.Load(&cfg); err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := content.SetTimezone(cfg.Content.Timezone); err != nil {
+		log.Fatalf("invalid CONTENT_TIMEZONE %q: %v", cfg.Content.Timezone, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	brokers := cfg.Kafka.Brokers
-	if len(brokers) == 0 {
-		brokers = []string{"localhost:9092"}
+	// DB: extraction rules stored with news_sources
+	sqldb, err := db.NewPostgres(cfg.Database)
+	if err != nil {
+		log.Fatalf("failed to connect postgres: %v", err)
+	}
+	defer sqldb.Close()
+	go content.DefaultRegistry.WatchSourceRules(ctx, repository.NewSourceRepo(sqldb).List, cfg.Content.RulesRefreshInterval, log.Default())
+	frontierRepo := repository.NewFrontierRepo(sqldb)
+	taskRepo := repository.NewTaskRepo(sqldb)
+	// recordFailure counts a page that cannot be turned into news in the errors of its task
+	recordFailure := func(ctx context.Context, raw *pipeline.RawMessage, outcome string) {
+		if raw.TaskID == "" {
+			return
+		}
+		recorded, err := frontierRepo.RecordOutcome(ctx, raw.TaskID, raw.URL, outcome)
+		if err != nil {
+			log.Printf("record outcome of task=%s url=%s: %v", raw.TaskID, raw.URL, err)
+		}
+		if recorded {
+			if _, err := taskRepo.CompleteIfSettled(ctx, raw.TaskID); err != nil {
+				log.Printf("complete task=%s: %v", raw.TaskID, err)
+			}
+		}
+	}
+	parseFailed := func(ctx context.Context, raw *pipeline.RawMessage) {
+		recordFailure(ctx, raw, domain.OutcomeParseFailed)
 	}
 
-	// reader: consume from news.raw（简单分区读取，从最早 offset 开始，方便本地调试）
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:     brokers,
-		Topic:       cfg.Kafka.TopicRaw,
-		Partition:   0,
-		StartOffset: kafka.FirstOffset,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-	})
-	defer reader.Close()
+	// consumer: consume from news.raw as a member of the parsed-producer group; failures go to news.raw.dlq.
+	// 放弃的页面如果还没有结果（例如写 news.parsed 一直失败），记为 produce_failed
+	consumer, err := ikafka.NewConsumer(cfg.Kafka, cfg.Kafka.TopicRaw, cfg.Kafka.TopicRawDLQ, "parsed-producer", func(ctx context.Context, m kafka.Message, err error) {
+		if raw, derr := pipeline.DecodeRaw(m.Value); derr == nil {
+			recordFailure(ctx, raw, domain.OutcomeProduceFailed)
+		}
+	}, log.Default())
+	if err != nil {
+		log.Fatalf("failed to create kafka consumer: %v", err)
+	}
+	defer consumer.Close()
+
+	store, err := blob.Open(cfg.Blob)
+	if err != nil {
+		log.Fatalf("failed to open blob store: %v", err)
+	}
 
 	// writer: produce to news.parsed
-	writer, err := ikafka.NewWriter(cfg.Kafka)
+	// 异步写入时 offset 可能先于投递提交，失败的消息只能记日志
+	writer, err := ikafka.NewWriter(cfg.Kafka, func(topic string, msgs []kafka.Message, err error) {
+		if err != nil {
+			log.Printf("delivery of %d messages to %s failed: %v", len(msgs), topic, err)
+		}
+	})
 	if err != nil {
 		log.Fatalf("failed to create kafka writer: %v", err)
 	}
@@ -70,25 +95,34 @@ func main() {
 
 	log.Printf("parsed-producer consuming from %s and producing to %s", cfg.Kafka.TopicRaw, cfg.Kafka.TopicParsed)
 
-	ctx := context.Background()
-	for {
-		m, err := reader.ReadMessage(ctx)
+	// 解码、解析失败是永久错误，直接进死信队列；写 Kafka 失败返回普通错误，由 consumer 重试
+	err = consumer.Run(ctx, func(ctx context.Context, m kafka.Message) error {
+		raw, err := pipeline.DecodeRaw(m.Value)
 		if err != nil {
-			log.Printf("read error from raw: %v", err)
-			time.Sleep(time.Second)
-			continue
+			return ikafka.Permanent(fmt.Errorf("decode raw: %w", err))
 		}
 
-		var raw RawMessage
-		if err := json.Unmarshal(m.Value, &raw); err != nil {
-			log.Printf("decode raw error at offset=%d: %v", m.Offset, err)
-			continue
+		html, err := raw.HTML(ctx, store)
+		if err != nil {
+			parseFailed(ctx, raw)
+			return ikafka.Permanent(fmt.Errorf("load body of %s: %w", raw.URL, err))
 		}
 
-		article, err := content.Parse(raw.SourceCode, raw.BodySnippet)
+		parser, err := content.DefaultRegistry.Resolve(raw.SourceCode, raw.URL)
 		if err != nil {
-			log.Printf("parse source=%s failed at offset=%d: %v", raw.SourceCode, m.Offset, err)
-			continue
+			parseFailed(ctx, raw)
+			return ikafka.Permanent(fmt.Errorf("no parser for source=%s url=%s: %w", raw.SourceCode, raw.URL, err))
+		}
+		article, err := parser.Parse(html)
+		if err != nil {
+			parseFailed(ctx, raw)
+			return ikafka.Permanent(fmt.Errorf("parse source=%s parser=%s charset=%s url=%s: %w", raw.SourceCode, parser.Name(), raw.Charset, raw.URL, err))
+		}
+
+		article.ResolveURLs(raw.URL)
+
+		if q, err := content.CheckQuality(html, article); err == nil && q.Suspicious {
+			log.Printf("parse quality warning: parser=%s url=%s coverage=%.2f parsed_runes=%d main_runes=%d", parser.Name(), raw.URL, q.Coverage, q.ParsedRunes, q.MainRunes)
 		}
 
 		h := sha256.New()
@@ -97,30 +131,47 @@ func main() {
 		h.Write([]byte(article.PublishTime.Format(time.RFC3339)))
 		hash := hex.EncodeToString(h.Sum(nil))
 
-		parsed := ParsedNews{
-			ID:          raw.TaskID + "::" + raw.URL, // 简单 ID，后续可换成 uuid/hash
-			TaskID:      raw.TaskID,
-			SourceID:    raw.SourceID,
-			SourceCode:  raw.SourceCode,
-			URL:         raw.URL,
-			Title:       article.Title,
-			Content:     article.Content,
-			PublishTime: article.PublishTime,
-			CrawlTime:   time.Now().UTC(),
-			Hash:        hash,
+		parsed := pipeline.ParsedNews{
+			Envelope:     pipeline.NewEnvelope(pipeline.ParsedVersion, "parsed-producer", raw.TraceID),
+			ID:           raw.TaskID + "::" + raw.URL, // 简单 ID，后续可换成 uuid/hash
+			TaskID:       raw.TaskID,
+			SourceID:     raw.SourceID,
+			SourceCode:   raw.SourceCode,
+			URL:          raw.URL,
+			Title:        article.Title,
+			Content:      article.Content,
+			Author:       article.Author,
+			Editor:       article.Editor,
+			OriginSource: article.OriginSource,
+			Summary:      article.Summary,
+			CanonicalURL: article.CanonicalURL,
+			LeadImage:    article.LeadImage,
+			Images:       article.Images,
+			Tags:         article.Tags,
+			Language:     article.Language,
+			PublishTime:  article.PublishTime,
+			CrawlTime:    time.Now().UTC(),
+			Hash:         hash,
 		}
 
 		b, err := json.Marshal(parsed)
 		if err != nil {
-			log.Printf("marshal parsed error at offset=%d: %v", m.Offset, err)
-			continue
+			return ikafka.Permanent(fmt.Errorf("marshal parsed: %w", err))
 		}
 
-		if err := writer.WriteParsed(ctx, b); err != nil {
-			log.Printf("write parsed error for task=%s: %v", raw.TaskID, err)
-			continue
+		// 按规范 URL 分区，同一篇文章的更新保持顺序
+		keyURL := article.CanonicalURL
+		if keyURL == "" {
+			keyURL = raw.URL
+		}
+		if err := writer.WriteParsed(ctx, ikafka.Key(keyURL), b); err != nil {
+			return fmt.Errorf("write parsed for task=%s: %w", raw.TaskID, err)
 		}
 
 		log.Printf("parsed-producer: produced parsed news for task=%s url=%s", raw.TaskID, raw.URL)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("consume %s: %v", cfg.Kafka.TopicRaw, err)
 	}
 }
@@ -2,14 +2,21 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/segmentio/kafka-go"
 
+	"recommand/internal/blob"
 	"recommand/internal/config"
 	"recommand/internal/content"
+	"recommand/internal/db"
+	ikafka "recommand/internal/kafka"
+	"recommand/internal/pipeline"
+	"recommand/internal/repository"
 )
 
 func main() {
@@ -17,58 +24,65 @@ func main() {
 	if err := config.Load(&cfg); err != nil {
 		log.Fatalf("failed to load config: %v", err)
 	}
+	if err := content.SetTimezone(cfg.Content.Timezone); err != nil {
+		log.Fatalf("invalid CONTENT_TIMEZONE %q: %v", cfg.Content.Timezone, err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	brokers := cfg.Kafka.Brokers
-	if len(brokers) == 0 {
-		brokers = []string{"localhost:9092"}
+	// 新的消费组从最早的 offset 开始读取；想重看历史消息时用 KAFKA_GROUP_ID 换一个新组
+	consumer, err := ikafka.NewConsumer(cfg.Kafka, cfg.Kafka.TopicRaw, "", "raw-consumer", nil, log.Default())
+	if err != nil {
+		log.Fatalf("failed to create kafka consumer: %v", err)
 	}
+	defer consumer.Close()
 
-	reader := kafka.NewReader(kafka.ReaderConfig{
-		Brokers:   brokers,
-		Topic:     cfg.Kafka.TopicRaw,
-		Partition: 0,
-		// 从最早的 offset 开始读取，便于本地调试时看到所有历史消息
-		StartOffset: kafka.FirstOffset,
-		MinBytes:    1,
-		MaxBytes:    10e6,
-	})
-	defer reader.Close()
+	// 规则存储在 news_sources 中；调试工具连不上数据库时只使用内置解析器
+	if sqldb, err := db.NewPostgres(cfg.Database); err != nil {
+		log.Printf("postgres unavailable, stored extraction rules disabled: %v", err)
+	} else {
+		defer sqldb.Close()
+		go content.DefaultRegistry.WatchSourceRules(ctx, repository.NewSourceRepo(sqldb).List, cfg.Content.RulesRefreshInterval, log.Default())
+	}
+
+	store, err := blob.Open(cfg.Blob)
+	if err != nil {
+		log.Fatalf("failed to open blob store: %v", err)
+	}
 
 	log.Printf("raw-consumer listening on topic %s", cfg.Kafka.TopicRaw)
 
-	ctx := context.Background()
-	for {
-		m, err := reader.ReadMessage(ctx)
+	err = consumer.Run(ctx, func(ctx context.Context, m kafka.Message) error {
+		// 反序列化 Engine 写入的原始 JSON
+		raw, err := pipeline.DecodeRaw(m.Value)
 		if err != nil {
-			log.Printf("read error: %v", err)
-			time.Sleep(time.Second)
-			continue
+			log.Printf("decode error at offset=%d: %v, raw=%s", m.Offset, err, string(m.Value))
+			return nil
 		}
 
-		// 反序列化 Engine 写入的原始 JSON
-		var raw struct {
-			TaskID      string `json:"task_id"`
-			SourceID    int64  `json:"source_id"`
-			SourceCode  string `json:"source_code"`
-			URL         string `json:"url"`
-			StatusCode  int    `json:"status_code"`
-			BodySnippet string `json:"body_snippet"`
+		log.Printf("%s: partition=%d offset=%d source=%s url=%s status=%d charset=%s body_size=%d schema_version=%d producer=%s trace_id=%s", cfg.Kafka.TopicRaw, m.Partition, m.Offset, raw.SourceCode, raw.URL, raw.StatusCode, raw.Charset, raw.BodySize, raw.Version(), raw.Producer, raw.TraceID)
+
+		// 通过解析器注册表为任意来源解析正文，便于调试新站点的解析效果
+		html, err := raw.HTML(ctx, store)
+		if err != nil {
+			log.Printf("load body of %s failed at offset=%d: %v", raw.URL, m.Offset, err)
+			return nil
 		}
-		if err := json.Unmarshal(m.Value, &raw); err != nil {
-			log.Printf("decode error at offset=%d: %v, raw=%s", m.Offset, err, string(m.Value))
-			continue
+		parser, err := content.DefaultRegistry.Resolve(raw.SourceCode, raw.URL)
+		if err != nil {
+			log.Printf("no parser for source=%s at offset=%d: %v", raw.SourceCode, m.Offset, err)
+			return nil
 		}
-
-		// 目前只处理 people_military，其它来源先打印原始 JSON
-		if raw.SourceCode == "people_military" {
-			article, err := content.ParsePeopleMilitary(raw.BodySnippet)
-			if err != nil {
-				log.Printf("parse people_military failed at offset=%d: %v", m.Offset, err)
-				continue
-			}
-			log.Printf("parsed article: task_id=%s title=%q publish_time=%s url=%s", raw.TaskID, article.Title, article.PublishTime.Format(time.RFC3339), raw.URL)
-		} else {
-			log.Printf("%s: partition=%d offset=%d source=%s url=%s status=%d", cfg.Kafka.TopicRaw, m.Partition, m.Offset, raw.SourceCode, raw.URL, raw.StatusCode)
+		article, err := parser.Parse(html)
+		if err != nil {
+			log.Printf("parse %s with %s failed at offset=%d: %v", raw.SourceCode, parser.Name(), m.Offset, err)
+			return nil
 		}
+		log.Printf("parsed article: task_id=%s parser=%s title=%q publish_time=%s url=%s", raw.TaskID, parser.Name(), article.Title, article.PublishTime.Format(time.RFC3339), raw.URL)
+		return nil
+	})
+	if err != nil {
+		log.Fatalf("consume %s: %v", cfg.Kafka.TopicRaw, err)
 	}
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+
+	"recommand/internal/pipeline"
+)
+
+// schema-export writes the JSON Schema of every pipeline topic, for teams consuming the
+// topics from other languages.
+func main() {
+	out := flag.String("out", "", "directory to write <topic>.v<version>.json files into (default: print to stdout)")
+	flag.Parse()
+
+	for _, t := range pipeline.Topics {
+		b, err := pipeline.JSONSchema(t)
+		if err != nil {
+			log.Fatalf("schema of %s: %v", t.Name, err)
+		}
+		if *out == "" {
+			fmt.Printf("%s\n", b)
+			continue
+		}
+		if err := os.MkdirAll(*out, 0o755); err != nil {
+			log.Fatalf("create %s: %v", *out, err)
+		}
+		path := filepath.Join(*out, fmt.Sprintf("%s.v%d.json", t.Name, t.Version))
+		if err := os.WriteFile(path, append(b, '\n'), 0o644); err != nil {
+			log.Fatalf("write %s: %v", path, err)
+		}
+		log.Printf("schema-export: wrote %s", path)
+	}
+}
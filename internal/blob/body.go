@@ -0,0 +1,92 @@
+package blob
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Body encodings used in raw messages.
+const (
+	EncodingPlain = ""
+	EncodingGzip  = "gzip+base64"
+)
+
+// ErrBodyTooLarge is returned by Pack when a body does not fit inline and no store is configured.
+var ErrBodyTooLarge = errors.New("body too large to send inline")
+
+// Packed is the form of a page body inside a message: either inline (plain or gzip+base64)
+// or a reference into a Store.
+type Packed struct {
+	Body     string
+	Encoding string
+	Ref      string
+	Size     int
+}
+
+// PackOptions controls how Pack stores a body.
+type PackOptions struct {
+	// CompressThreshold is the body size from which the body is gzip compressed.
+	CompressThreshold int
+	// InlineMax is the largest encoded body sent inline; larger bodies go to the store.
+	InlineMax int
+}
+
+// Pack prepares a body for a message. store may be nil.
+func Pack(ctx context.Context, data []byte, opts PackOptions, store Store) (Packed, error) {
+	p := Packed{Body: string(data), Encoding: EncodingPlain, Size: len(data)}
+	if opts.CompressThreshold > 0 && len(data) >= opts.CompressThreshold {
+		var buf bytes.Buffer
+		zw := gzip.NewWriter(&buf)
+		if _, err := zw.Write(data); err != nil {
+			return Packed{}, err
+		}
+		if err := zw.Close(); err != nil {
+			return Packed{}, err
+		}
+		p.Body = base64.StdEncoding.EncodeToString(buf.Bytes())
+		p.Encoding = EncodingGzip
+	}
+	if opts.InlineMax <= 0 || len(p.Body) <= opts.InlineMax {
+		return p, nil
+	}
+	if store == nil {
+		return Packed{}, fmt.Errorf("%w: %d bytes", ErrBodyTooLarge, len(p.Body))
+	}
+	ref, err := store.Put(ctx, data)
+	if err != nil {
+		return Packed{}, fmt.Errorf("store body: %w", err)
+	}
+	return Packed{Ref: ref, Size: len(data)}, nil
+}
+
+// Unpack returns the original body bytes. store may be nil when p has no Ref.
+func Unpack(ctx context.Context, p Packed, store Store) ([]byte, error) {
+	if p.Ref != "" {
+		if store == nil {
+			return nil, fmt.Errorf("body stored as %s but no blob store is configured", p.Ref)
+		}
+		return store.Get(ctx, p.Ref)
+	}
+	switch p.Encoding {
+	case EncodingPlain:
+		return []byte(p.Body), nil
+	case EncodingGzip:
+		raw, err := base64.StdEncoding.DecodeString(p.Body)
+		if err != nil {
+			return nil, err
+		}
+		zr, err := gzip.NewReader(bytes.NewReader(raw))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(zr)
+	default:
+		return nil, fmt.Errorf("unknown body encoding %q", p.Encoding)
+	}
+}
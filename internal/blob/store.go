@@ -0,0 +1,118 @@
+package blob
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"recommand/internal/config"
+)
+
+// ErrNotFound is returned by Get when no blob exists for a reference.
+var ErrNotFound = errors.New("blob not found")
+
+const refPrefix = "sha256:"
+
+// Store is a content-addressed blob store: the reference of a blob is derived from its content.
+type Store interface {
+	Put(ctx context.Context, data []byte) (string, error)
+	Get(ctx context.Context, ref string) ([]byte, error)
+}
+
+// FileStore keeps blobs as files under a directory shared by the crawler and the pipeline workers,
+// e.g. <dir>/ab/cd/abcd1234... for reference sha256:abcd1234....
+type FileStore struct {
+	dir string
+}
+
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir}, nil
+}
+
+// Open returns the store configured by cfg, or nil when BLOB_DIR is not set.
+func Open(cfg config.BlobConfig) (Store, error) {
+	if cfg.Dir == "" {
+		return nil, nil
+	}
+	s, err := NewFileStore(cfg.Dir)
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Options returns the pack options configured by cfg.
+func Options(cfg config.BlobConfig) PackOptions {
+	return PackOptions{CompressThreshold: cfg.CompressThreshold, InlineMax: cfg.InlineMax}
+}
+
+// Ref returns the content address of data.
+func Ref(data []byte) string {
+	sum := sha256.Sum256(data)
+	return refPrefix + hex.EncodeToString(sum[:])
+}
+
+func (s *FileStore) Put(_ context.Context, data []byte) (string, error) {
+	ref := Ref(data)
+	p, err := s.path(ref)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(p); err == nil {
+		// 同样的内容已经存在，直接复用
+		return ref, nil
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	// 先写临时文件再 rename，避免读者看到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".tmp-*")
+	if err != nil {
+		return "", err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), p); err != nil {
+		os.Remove(tmp.Name())
+		return "", err
+	}
+	return ref, nil
+}
+
+func (s *FileStore) Get(_ context.Context, ref string) ([]byte, error) {
+	p, err := s.path(ref)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, ErrNotFound
+	}
+	return data, err
+}
+
+func (s *FileStore) path(ref string) (string, error) {
+	sum := strings.TrimPrefix(ref, refPrefix)
+	if len(sum) != sha256.Size*2 || sum == ref {
+		return "", fmt.Errorf("invalid blob ref %q", ref)
+	}
+	if _, err := hex.DecodeString(sum); err != nil {
+		return "", fmt.Errorf("invalid blob ref %q", ref)
+	}
+	return filepath.Join(s.dir, sum[:2], sum[2:4], sum), nil
+}
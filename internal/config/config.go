@@ -1,12 +1,20 @@
 package config
 
-import "github.com/kelseyhightower/envconfig"
+import (
+	"time"
+
+	"github.com/kelseyhightower/envconfig"
+)
 
 type Config struct {
-	HTTP     HTTPConfig
-	Database DatabaseConfig
-	Kafka    KafkaConfig
-	ES       ESConfig
+	HTTP      HTTPConfig
+	Database  DatabaseConfig
+	Kafka     KafkaConfig
+	ES        ESConfig
+	Scheduler SchedulerConfig
+	Crawler   CrawlerConfig
+	Blob      BlobConfig
+	Content   ContentConfig
 }
 
 type HTTPConfig struct {
@@ -21,6 +29,36 @@ type KafkaConfig struct {
 	Brokers     []string `envconfig:"KAFKA_BROKERS" default:"localhost:9092"`
 	TopicRaw    string   `envconfig:"KAFKA_TOPIC_RAW" default:"news.raw"`
 	TopicParsed string   `envconfig:"KAFKA_TOPIC_PARSED" default:"news.parsed"`
+	// BatchSize, BatchBytes and Linger bound a producer batch: it is sent once it has BatchSize
+	// messages or BatchBytes bytes, or Linger after its first message.
+	BatchSize  int           `envconfig:"KAFKA_BATCH_SIZE" default:"100"`
+	BatchBytes int64         `envconfig:"KAFKA_BATCH_BYTES" default:"1048576"`
+	Linger     time.Duration `envconfig:"KAFKA_LINGER" default:"10ms"`
+	// Compression is none, gzip, snappy, lz4 or zstd.
+	Compression string `envconfig:"KAFKA_COMPRESSION" default:"snappy"`
+	// RequiredAcks is none, one or all.
+	RequiredAcks string `envconfig:"KAFKA_REQUIRED_ACKS" default:"all"`
+	// Async makes writes return before delivery; failed deliveries are reported to a callback.
+	Async bool `envconfig:"KAFKA_ASYNC" default:"false"`
+	// TLSEnabled connects to the brokers over TLS. TLSCAFile adds a custom CA; TLSCertFile and
+	// TLSKeyFile set a client certificate for mutual TLS.
+	TLSEnabled            bool   `envconfig:"KAFKA_TLS_ENABLED" default:"false"`
+	TLSCAFile             string `envconfig:"KAFKA_TLS_CA_FILE" default:""`
+	TLSCertFile           string `envconfig:"KAFKA_TLS_CERT_FILE" default:""`
+	TLSKeyFile            string `envconfig:"KAFKA_TLS_KEY_FILE" default:""`
+	TLSServerName         string `envconfig:"KAFKA_TLS_SERVER_NAME" default:""`
+	TLSInsecureSkipVerify bool   `envconfig:"KAFKA_TLS_INSECURE_SKIP_VERIFY" default:"false"`
+	// SASLMechanism is none, plain, scram-sha-256 or scram-sha-512.
+	SASLMechanism string `envconfig:"KAFKA_SASL_MECHANISM" default:"none"`
+	SASLUsername  string `envconfig:"KAFKA_SASL_USERNAME" default:""`
+	SASLPassword  string `envconfig:"KAFKA_SASL_PASSWORD" default:""`
+	// TopicRawDLQ and TopicParsedDLQ receive the messages of news.raw and news.parsed whose handling failed.
+	TopicRawDLQ    string `envconfig:"KAFKA_TOPIC_RAW_DLQ" default:"news.raw.dlq"`
+	TopicParsedDLQ string `envconfig:"KAFKA_TOPIC_PARSED_DLQ" default:"news.parsed.dlq"`
+	// GroupID is the consumer group of pipeline workers; empty uses the name of the service.
+	GroupID string `envconfig:"KAFKA_GROUP_ID" default:""`
+	// HandlerRetries is how often a consumer retries a message whose handling failed.
+	HandlerRetries int `envconfig:"KAFKA_HANDLER_RETRIES" default:"3"`
 }
 
 type ESConfig struct {
@@ -28,6 +66,61 @@ type ESConfig struct {
 	Username string `envconfig:"ES_USERNAME" default:"elastic"`
 	Password string `envconfig:"ES_PASSWORD" default:""`
 	Index    string `envconfig:"ES_INDEX" default:"news"`
+	// APIKey is the base64 encoded API key; when set it is used instead of username/password.
+	APIKey string `envconfig:"ES_API_KEY" default:""`
+	// CAFile is a PEM bundle of the CAs that signed the cluster certificates.
+	CAFile   string `envconfig:"ES_CA_FILE" default:""`
+	CertFile string `envconfig:"ES_CLIENT_CERT_FILE" default:""`
+	KeyFile  string `envconfig:"ES_CLIENT_KEY_FILE" default:""`
+	// CertFingerprint pins the SHA-256 fingerprint of a cluster certificate (hex, colons allowed).
+	CertFingerprint string `envconfig:"ES_CERT_FINGERPRINT" default:""`
+	// InsecureSkipVerify disables certificate verification; local development only.
+	InsecureSkipVerify bool `envconfig:"ES_INSECURE_SKIP_VERIFY" default:"false"`
+}
+
+type SchedulerConfig struct {
+	Enabled      bool          `envconfig:"SCHEDULER_ENABLED" default:"true"`
+	TickInterval time.Duration `envconfig:"SCHEDULER_TICK_INTERVAL" default:"1m"`
+	MaxJitter    time.Duration `envconfig:"SCHEDULER_MAX_JITTER" default:"5m"`
+}
+
+type CrawlerConfig struct {
+	UserAgent         string        `envconfig:"CRAWLER_USER_AGENT" default:"recommand-crawler/1.0 (+https://github.com/jamesfeng2009/recommand)"`
+	RequestTimeout    time.Duration `envconfig:"CRAWLER_REQUEST_TIMEOUT" default:"30s"`
+	RequestsPerSecond float64       `envconfig:"CRAWLER_REQUESTS_PER_SECOND" default:"1"`
+	RespectRobots     bool          `envconfig:"CRAWLER_RESPECT_ROBOTS" default:"true"`
+	RobotsCacheTTL    time.Duration `envconfig:"CRAWLER_ROBOTS_CACHE_TTL" default:"1h"`
+	MaxBodyBytes      int64         `envconfig:"CRAWLER_MAX_BODY_BYTES" default:"10485760"`
+	// MaxRetries is how often a transient fetch failure (timeout, network, 5xx, 429) is retried.
+	MaxRetries     int           `envconfig:"CRAWLER_MAX_RETRIES" default:"3"`
+	RetryBaseDelay time.Duration `envconfig:"CRAWLER_RETRY_BASE_DELAY" default:"1s"`
+	// RetryMaxDelay caps the backoff; a longer Retry-After gives the URL up.
+	RetryMaxDelay time.Duration `envconfig:"CRAWLER_RETRY_MAX_DELAY" default:"1m"`
+	// MaxErrorRate fails a task once this share of its URLs failed, after MinErrorSample URLs.
+	MaxErrorRate   float64 `envconfig:"CRAWLER_MAX_ERROR_RATE" default:"0.5"`
+	MinErrorSample int     `envconfig:"CRAWLER_MIN_ERROR_SAMPLE" default:"20"`
+	// ConditionalGet sends If-None-Match/If-Modified-Since on recrawls of incremental tasks.
+	ConditionalGet bool `envconfig:"CRAWLER_CONDITIONAL_GET" default:"true"`
+	// TaskStaleAfter is how long a task may go without heartbeat before another engine adopts it.
+	TaskStaleAfter time.Duration `envconfig:"CRAWLER_TASK_STALE_AFTER" default:"2m"`
+	// ParseTimeout is how long a task waits for the pipeline without any progress before it completes anyway.
+	ParseTimeout time.Duration `envconfig:"CRAWLER_PARSE_TIMEOUT" default:"30m"`
+}
+
+// BlobConfig controls how page bodies are carried in news.raw. Bodies from
+// CompressThreshold bytes are gzip compressed; bodies still larger than InlineMax
+// are written to the blob store under Dir (shared by crawler and workers).
+type BlobConfig struct {
+	Dir               string `envconfig:"BLOB_DIR" default:""`
+	CompressThreshold int    `envconfig:"RAW_COMPRESS_THRESHOLD_BYTES" default:"65536"`
+	InlineMax         int    `envconfig:"RAW_INLINE_MAX_BYTES" default:"786432"`
+}
+
+type ContentConfig struct {
+	// Timezone interprets publish times that carry no explicit offset.
+	Timezone string `envconfig:"CONTENT_TIMEZONE" default:"Asia/Shanghai"`
+	// RulesRefreshInterval is how often parser workers reload extraction rules from news_sources.
+	RulesRefreshInterval time.Duration `envconfig:"CONTENT_RULES_REFRESH_INTERVAL" default:"1m"`
 }
 
 func Load(cfg *Config) error {
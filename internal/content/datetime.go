@@ -0,0 +1,226 @@
+package content
+
+import (
+	"encoding/json"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	// 内置时区数据，容器里没有 /usr/share/zoneinfo 时也能加载 Asia/Shanghai
+	_ "time/tzdata"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// DefaultTimezone is the zone of publish times that carry no explicit offset.
+const DefaultTimezone = "Asia/Shanghai"
+
+var location atomic.Pointer[time.Location]
+
+func init() {
+	loc, err := time.LoadLocation(DefaultTimezone)
+	if err != nil {
+		loc = time.FixedZone("CST", 8*3600)
+	}
+	location.Store(loc)
+}
+
+// SetTimezone sets the zone used to interpret publish times without an explicit offset.
+func SetTimezone(name string) error {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		return err
+	}
+	location.Store(loc)
+	return nil
+}
+
+// Location returns the zone used to interpret publish times without an explicit offset.
+func Location() *time.Location {
+	return location.Load()
+}
+
+// DateMatch is a date found in free text.
+type DateMatch struct {
+	Time time.Time
+	// HasClock is false when the text only carried a day, e.g. "2024-03-05".
+	HasClock bool
+}
+
+var (
+	isoPattern = regexp.MustCompile(`\d{4}-\d{2}-\d{2}T\d{2}:\d{2}(?::\d{2}(?:\.\d+)?)?(?:Z|[+-]\d{2}:?\d{2})?`)
+	// 2024年03月05日08:12 / 2024-3-5 08:12:30 / 2024/03/05 / 2024.03.05
+	absPattern      = regexp.MustCompile(`(\d{4})\s*[年\-/.]\s*(\d{1,2})\s*[月\-/.]\s*(\d{1,2})\s*日?(?:\s*(\d{1,2})\s*[:：时]\s*(\d{1,2})(?:\s*[:：分]\s*(\d{1,2}))?)?`)
+	relativePattern = regexp.MustCompile(`(\d+)\s*(秒|分钟|小时|天|周)前`)
+	dayWordPattern  = regexp.MustCompile(`(今天|昨天|前天)\s*(?:(\d{1,2})[:：](\d{2}))?`)
+)
+
+// FindDate finds the first publish date inside text such as "2024年03月05日08:12 来源：人民网".
+// It understands ISO 8601, Chinese, dash/slash/dot separated and relative ("3小时前", "昨天 08:00")
+// formats. Times without an offset are interpreted in Location(); relative ones are based on now.
+func FindDate(text string, now time.Time) (DateMatch, bool) {
+	loc := Location()
+	now = now.In(loc)
+
+	if m := isoPattern.FindString(text); m != "" {
+		if t, ok := parseISO(m, loc); ok {
+			return DateMatch{Time: t, HasClock: true}, true
+		}
+	}
+	if m := absPattern.FindStringSubmatch(text); m != nil {
+		y, _ := strconv.Atoi(m[1])
+		mo, _ := strconv.Atoi(m[2])
+		d, _ := strconv.Atoi(m[3])
+		if validDate(y, mo, d) {
+			h, mi, sec := atoi(m[4]), atoi(m[5]), atoi(m[6])
+			if h < 24 && mi < 60 && sec < 60 {
+				return DateMatch{Time: time.Date(y, time.Month(mo), d, h, mi, sec, 0, loc), HasClock: m[4] != ""}, true
+			}
+		}
+	}
+	if m := relativePattern.FindStringSubmatch(text); m != nil {
+		n := atoi(m[1])
+		var d time.Duration
+		switch m[2] {
+		case "秒":
+			d = time.Duration(n) * time.Second
+		case "分钟":
+			d = time.Duration(n) * time.Minute
+		case "小时":
+			d = time.Duration(n) * time.Hour
+		case "天":
+			d = time.Duration(n) * 24 * time.Hour
+		case "周":
+			d = time.Duration(n) * 7 * 24 * time.Hour
+		}
+		return DateMatch{Time: now.Add(-d).Truncate(time.Minute), HasClock: true}, true
+	}
+	if strings.Contains(text, "刚刚") {
+		return DateMatch{Time: now.Truncate(time.Minute), HasClock: true}, true
+	}
+	if m := dayWordPattern.FindStringSubmatch(text); m != nil {
+		day := now
+		switch m[1] {
+		case "昨天":
+			day = now.AddDate(0, 0, -1)
+		case "前天":
+			day = now.AddDate(0, 0, -2)
+		}
+		h, mi := atoi(m[2]), atoi(m[3])
+		if h < 24 && mi < 60 {
+			return DateMatch{Time: time.Date(day.Year(), day.Month(), day.Day(), h, mi, 0, 0, loc), HasClock: m[2] != ""}, true
+		}
+	}
+	return DateMatch{}, false
+}
+
+// ParseDate parses text with the given layouts in Location(), then falls back to FindDate.
+func ParseDate(text string, layouts []string, now time.Time) (time.Time, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, text, Location()); err == nil {
+			return t, true
+		}
+	}
+	if m, ok := FindDate(text, now); ok {
+		return m.Time, true
+	}
+	return time.Time{}, false
+}
+
+// publishTimeMeta are <meta> tags that carry the publish time, in order of preference.
+var publishTimeMeta = []string{
+	`meta[property="article:published_time"]`,
+	`meta[property="og:article:published_time"]`,
+	`meta[itemprop="datePublished"]`,
+	`meta[name="publishdate"]`,
+	`meta[name="PubDate"]`,
+	`meta[name="pubdate"]`,
+	`meta[name="publish-date"]`,
+	`meta[name="weibo: article:create_at"]`,
+}
+
+// ExtractPublishTime reads the publish time from page metadata: <meta> tags such as
+// article:published_time, then JSON-LD datePublished.
+func ExtractPublishTime(doc *goquery.Document, now time.Time) (time.Time, bool) {
+	for _, sel := range publishTimeMeta {
+		v, ok := doc.Find(sel).First().Attr("content")
+		if !ok {
+			continue
+		}
+		if m, ok := FindDate(v, now); ok {
+			return m.Time, true
+		}
+	}
+
+	var (
+		found time.Time
+		ok    bool
+	)
+	doc.Find(`script[type="application/ld+json"]`).EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		var v any
+		if err := json.Unmarshal([]byte(s.Text()), &v); err != nil {
+			return true
+		}
+		if raw := findJSONLDString(v, "datePublished"); raw != "" {
+			if m, matched := FindDate(raw, now); matched {
+				found, ok = m.Time, true
+				return false
+			}
+		}
+		return true
+	})
+	return found, ok
+}
+
+// findJSONLDString walks a decoded JSON-LD value (object, array or @graph) for a string key.
+func findJSONLDString(v any, key string) string {
+	switch t := v.(type) {
+	case map[string]any:
+		if s, ok := t[key].(string); ok && s != "" {
+			return s
+		}
+		for _, child := range t {
+			if s := findJSONLDString(child, key); s != "" {
+				return s
+			}
+		}
+	case []any:
+		for _, child := range t {
+			if s := findJSONLDString(child, key); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+func parseISO(s string, loc *time.Location) (time.Time, bool) {
+	for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05-0700", "2006-01-02T15:04-07:00", "2006-01-02T15:04Z07:00"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, true
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05.999999999", "2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+func validDate(y, m, d int) bool {
+	if y < 1990 || y > 2100 || m < 1 || m > 12 || d < 1 {
+		return false
+	}
+	return d <= time.Date(y, time.Month(m)+1, 0, 0, 0, 0, 0, time.UTC).Day()
+}
+
+func atoi(s string) int {
+	n, _ := strconv.Atoi(s)
+	return n
+}
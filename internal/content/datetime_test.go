@@ -0,0 +1,62 @@
+package content
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFindDate(t *testing.T) {
+	shanghai := Location()
+	now := time.Date(2024, 3, 5, 10, 30, 0, 0, shanghai)
+
+	tests := []struct {
+		name      string
+		text      string
+		want      time.Time
+		wantClock bool
+		wantOK    bool
+	}{
+		{"chinese with clock", "2024年03月05日08:12 来源：人民网", time.Date(2024, 3, 5, 8, 12, 0, 0, shanghai), true, true},
+		{"chinese date only", "发布时间：2024年3月5日", time.Date(2024, 3, 5, 0, 0, 0, 0, shanghai), false, true},
+		{"dash with seconds", "2024-3-5 08:12:30", time.Date(2024, 3, 5, 8, 12, 30, 0, shanghai), true, true},
+		{"slash", "2024/03/05", time.Date(2024, 3, 5, 0, 0, 0, 0, shanghai), false, true},
+		{"dot", "2024.03.05 08:12", time.Date(2024, 3, 5, 8, 12, 0, 0, shanghai), true, true},
+		{"iso with offset", "2024-03-05T08:12:00Z", time.Date(2024, 3, 5, 8, 12, 0, 0, time.UTC), true, true},
+		{"iso without offset uses location", "2024-03-05T08:12:00", time.Date(2024, 3, 5, 8, 12, 0, 0, shanghai), true, true},
+		{"hours ago", "3小时前", time.Date(2024, 3, 5, 7, 30, 0, 0, shanghai), true, true},
+		{"days ago", "2天前", time.Date(2024, 3, 3, 10, 30, 0, 0, shanghai), true, true},
+		{"just now", "刚刚", now, true, true},
+		{"yesterday with clock", "昨天 08:00", time.Date(2024, 3, 4, 8, 0, 0, 0, shanghai), true, true},
+		{"day before yesterday", "前天", time.Date(2024, 3, 3, 0, 0, 0, 0, shanghai), false, true},
+		{"invalid month", "2024-13-05", time.Time{}, false, false},
+		{"no date", "来源：人民网", time.Time{}, false, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, ok := FindDate(tt.text, now)
+			if ok != tt.wantOK {
+				t.Fatalf("FindDate(%q) ok = %v, want %v (got %s)", tt.text, ok, tt.wantOK, m.Time)
+			}
+			if !ok {
+				return
+			}
+			if !m.Time.Equal(tt.want) {
+				t.Errorf("FindDate(%q) = %s, want %s", tt.text, m.Time, tt.want)
+			}
+			if m.HasClock != tt.wantClock {
+				t.Errorf("FindDate(%q) HasClock = %v, want %v", tt.text, m.HasClock, tt.wantClock)
+			}
+		})
+	}
+}
+
+func TestFindDateTimezone(t *testing.T) {
+	defer SetTimezone(DefaultTimezone)
+	if err := SetTimezone("UTC"); err != nil {
+		t.Fatal(err)
+	}
+	m, ok := FindDate("2024年03月05日08:12", time.Now())
+	if !ok || !m.Time.Equal(time.Date(2024, 3, 5, 8, 12, 0, 0, time.UTC)) {
+		t.Fatalf("FindDate in UTC = %s, %v", m.Time, ok)
+	}
+}
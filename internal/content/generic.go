@@ -0,0 +1,55 @@
+package content
+
+import (
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+func init() {
+	DefaultRegistry.SetFallback(NewParserFunc("generic", ParseGeneric))
+}
+
+// genericTimeSelectors are common containers of the publish time on news pages.
+var genericTimeSelectors = []string{"time", ".time", ".pubtime", ".pubTime", ".pub_time", ".publish-time", ".date", ".info", ".source"}
+
+// ParseGeneric is the fallback parser for sources without a site-specific parser.
+// The title comes from <h1>, og:title or <title>; the body from the readability extractor
+// and the publish time from page metadata or common time containers. Author, editor, source,
+// images and tags come from page metadata and the byline.
+func ParseGeneric(html string) (*Article, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+
+	var a Article
+
+	if h1 := strings.TrimSpace(doc.Find("h1").First().Text()); h1 != "" {
+		a.Title = h1
+	} else if og, ok := doc.Find(`meta[property="og:title"]`).Attr("content"); ok && strings.TrimSpace(og) != "" {
+		a.Title = strings.TrimSpace(og)
+	} else {
+		a.Title = strings.TrimSpace(doc.Find("title").First().Text())
+	}
+
+	body := ExtractMain(doc)
+	a.Content = paragraphText(body)
+
+	now := time.Now()
+	if t, ok := ExtractPublishTime(doc, now); ok {
+		a.PublishTime = t
+	} else {
+		for _, sel := range genericTimeSelectors {
+			if m, ok := FindDate(doc.Find(sel).First().Text(), now); ok {
+				a.PublishTime = m.Time
+				break
+			}
+		}
+	}
+
+	fillMetadata(doc, body, &a)
+
+	return &a, nil
+}
@@ -0,0 +1,227 @@
+package content
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+var (
+	// 作者：张三 / 记者 张三 / 责任编辑：李四 / (责编：李四) / 来源：人民网-军事频道
+	authorLinePattern = regexp.MustCompile(`(?:作者|记者)\s*[:：]\s*([^\s|/()（）【】\[\]，,:：]{1,20})`)
+	editorLinePattern = regexp.MustCompile(`(?:责任编辑|责编|编辑)\s*[:：]\s*([^\s|/()（）【】\[\]，,]{1,20})`)
+	originLinePattern = regexp.MustCompile(`来源\s*[:：]\s*([^\s|()（）【】\[\]，,]{1,40})`)
+	// labelPrefix strips labels kept by rule selectors, e.g. "（责编：李四）" → "李四".
+	labelPrefix = regexp.MustCompile(`^[\s(（【\[]*(?:责任编辑|责编|编辑|作者|记者|来源)\s*[:：]\s*`)
+)
+
+// bylineTailRunes is how much of the end of the body is searched for editor/source lines.
+const bylineTailRunes = 200
+
+// tagSeparators split meta keywords such as "军事,国防；装备 、训练".
+var tagSeparators = func(r rune) bool {
+	switch r {
+	case ',', '，', ';', '；', '、', '|':
+		return true
+	}
+	return false
+}
+
+// fillMetadata fills the fields of a that the parser left empty from page metadata
+// (<meta>, <link rel=canonical>, <html lang>) and from the byline text of the page.
+// body is the article body node, used for inline images; it may be empty.
+func fillMetadata(doc *goquery.Document, body *goquery.Selection, a *Article) {
+	byline := bylineText(doc, body)
+
+	if a.Author == "" {
+		if v := metaContent(doc, `meta[name="author"]`, `meta[property="article:author"]`); v != "" && !isURL(v) {
+			a.Author = v
+		} else if m := authorLinePattern.FindStringSubmatch(byline); m != nil {
+			a.Author = strings.TrimSpace(m[1])
+		}
+	}
+	if a.Editor == "" {
+		if m := editorLinePattern.FindStringSubmatch(byline); m != nil {
+			a.Editor = m[1]
+		}
+	}
+	if a.OriginSource == "" {
+		if v := metaContent(doc, `meta[name="source"]`, `meta[name="ContentSource"]`); v != "" {
+			a.OriginSource = v
+		} else if m := originLinePattern.FindStringSubmatch(byline); m != nil {
+			a.OriginSource = m[1]
+		}
+	}
+	a.Author, a.Editor, a.OriginSource = cleanLabel(a.Author), cleanLabel(a.Editor), cleanLabel(a.OriginSource)
+
+	if a.Summary == "" {
+		a.Summary = metaContent(doc, `meta[name="description"]`, `meta[property="og:description"]`, `meta[name="Description"]`)
+	}
+	if a.CanonicalURL == "" {
+		if href, ok := doc.Find(`link[rel="canonical"]`).First().Attr("href"); ok && strings.TrimSpace(href) != "" {
+			a.CanonicalURL = strings.TrimSpace(href)
+		} else {
+			a.CanonicalURL = metaContent(doc, `meta[property="og:url"]`)
+		}
+	}
+
+	if len(a.Images) == 0 && body != nil {
+		seen := map[string]bool{}
+		body.Find("img").Each(func(_ int, img *goquery.Selection) {
+			src := imageSource(img)
+			if src == "" || seen[src] {
+				return
+			}
+			seen[src] = true
+			a.Images = append(a.Images, src)
+		})
+	}
+	if a.LeadImage == "" {
+		a.LeadImage = metaContent(doc, `meta[property="og:image"]`, `meta[name="twitter:image"]`)
+		if a.LeadImage == "" && len(a.Images) > 0 {
+			a.LeadImage = a.Images[0]
+		}
+	}
+
+	if len(a.Tags) == 0 {
+		var raw []string
+		doc.Find(`meta[property="article:tag"]`).Each(func(_ int, s *goquery.Selection) {
+			if v, ok := s.Attr("content"); ok {
+				raw = append(raw, v)
+			}
+		})
+		if len(raw) == 0 {
+			raw = append(raw, metaContent(doc, `meta[name="keywords"]`, `meta[name="Keywords"]`))
+		}
+		a.Tags = splitTags(raw)
+	}
+
+	if a.Language == "" {
+		a.Language = pageLanguage(doc, a.Title+a.Content)
+	}
+}
+
+// ResolveURLs makes the canonical URL and image URLs of the article absolute,
+// relative to the URL the page was fetched from.
+func (a *Article) ResolveURLs(pageURL string) {
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return
+	}
+	resolve := func(ref string) string {
+		if ref == "" || strings.HasPrefix(ref, "data:") {
+			return ref
+		}
+		u, err := base.Parse(ref)
+		if err != nil {
+			return ref
+		}
+		return u.String()
+	}
+	a.CanonicalURL = resolve(a.CanonicalURL)
+	a.LeadImage = resolve(a.LeadImage)
+	for i, img := range a.Images {
+		a.Images[i] = resolve(img)
+	}
+}
+
+// bylineText returns the text that usually carries author, editor and source lines:
+// the common info containers above the article, the end of the body and the text right after it.
+func bylineText(doc *goquery.Document, body *goquery.Selection) string {
+	var parts []string
+	doc.Find(".info, .source, .author, .edit, .editor, .byline, .meta, .article-info, .rm_txt_time, .souce, .header-time, .pages-date").Each(func(_ int, s *goquery.Selection) {
+		parts = append(parts, s.Text())
+	})
+	if body != nil && body.Length() > 0 {
+		// 只取正文末尾，避免正文里引用的"来源："被当成文章来源
+		text := []rune(strings.TrimSpace(body.Text()))
+		if len(text) > bylineTailRunes {
+			text = text[len(text)-bylineTailRunes:]
+		}
+		parts = append(parts, string(text), body.NextAll().Text())
+	}
+	return strings.Join(parts, "\n")
+}
+
+// metaContent returns the first non-empty content attribute of the given <meta> selectors.
+func metaContent(doc *goquery.Document, selectors ...string) string {
+	for _, sel := range selectors {
+		if v, ok := doc.Find(sel).First().Attr("content"); ok {
+			if v = strings.TrimSpace(v); v != "" {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+// imageSource returns the image URL of an <img>, preferring lazy-load attributes.
+func imageSource(img *goquery.Selection) string {
+	for _, attr := range []string{"data-src", "data-original", "src"} {
+		if v, ok := img.Attr(attr); ok {
+			v = strings.TrimSpace(v)
+			if v != "" && !strings.HasPrefix(v, "data:") {
+				return v
+			}
+		}
+	}
+	return ""
+}
+
+func splitTags(raw []string) []string {
+	var tags []string
+	seen := map[string]bool{}
+	for _, r := range raw {
+		for _, t := range strings.FieldsFunc(r, tagSeparators) {
+			t = strings.TrimSpace(t)
+			if t == "" || seen[t] {
+				continue
+			}
+			seen[t] = true
+			tags = append(tags, t)
+		}
+	}
+	return tags
+}
+
+func cleanLabel(s string) string {
+	s = labelPrefix.ReplaceAllString(strings.TrimSpace(s), "")
+	return strings.TrimSpace(strings.TrimRight(s, ")）】]"))
+}
+
+// pageLanguage reads <html lang> or Content-Language, and otherwise guesses zh/en from the text.
+func pageLanguage(doc *goquery.Document, text string) string {
+	lang, _ := doc.Find("html").First().Attr("lang")
+	if lang == "" {
+		lang = metaContent(doc, `meta[http-equiv="Content-Language"]`, `meta[http-equiv="content-language"]`)
+	}
+	if lang = strings.TrimSpace(lang); lang != "" {
+		return strings.ToLower(lang)
+	}
+
+	var han, latin int
+	for _, r := range text {
+		switch {
+		case unicode.Is(unicode.Han, r):
+			han++
+		case r < unicode.MaxASCII && unicode.IsLetter(r):
+			latin++
+		}
+	}
+	switch {
+	case han == 0 && latin == 0:
+		return ""
+	case han*3 >= latin:
+		// 一个汉字大约对应英文的 3 个字母
+		return "zh"
+	default:
+		return "en"
+	}
+}
+
+func isURL(s string) bool {
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
@@ -0,0 +1,133 @@
+package content
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"recommand/internal/domain"
+)
+
+func TestFillMetadata(t *testing.T) {
+	tests := []struct {
+		name   string
+		html   string
+		parsed Article
+		want   Article
+	}{
+		{
+			name: "page metadata",
+			html: `<html lang="zh-CN"><head>
+<meta name="author" content="张三">
+<meta name="source" content="新华社">
+<meta name="description" content="文章摘要">
+<meta name="keywords" content="军事,国防；装备 、训练,军事">
+<meta property="og:image" content="/lead.jpg">
+<link rel="canonical" href="https://example.com/a.html">
+</head><body><div id="zw"><p>正文</p><img src="/1.jpg"><img data-src="/2.jpg" src="data:image/gif;base64,R0lGOD"><img src="/1.jpg"></div></body></html>`,
+			want: Article{
+				Author:       "张三",
+				OriginSource: "新华社",
+				Summary:      "文章摘要",
+				CanonicalURL: "https://example.com/a.html",
+				LeadImage:    "/lead.jpg",
+				Images:       []string{"/1.jpg", "/2.jpg"},
+				Tags:         []string{"军事", "国防", "装备", "训练"},
+				Language:     "zh-cn",
+			},
+		},
+		{
+			name: "byline",
+			html: `<html><head><meta name="author" content="https://example.com/staff/1"><meta property="og:url" content="https://example.com/b.html"></head><body>
+<div class="info">2024年03月05日08:12 来源：人民网-军事频道 作者：张三</div>
+<div id="zw"><p>新型装备已完成测试。</p><p>（责编：李四）</p></div>
+</body></html>`,
+			want: Article{
+				Author:       "张三",
+				Editor:       "李四",
+				OriginSource: "人民网-军事频道",
+				CanonicalURL: "https://example.com/b.html",
+				Language:     "zh",
+			},
+		},
+		{
+			name:   "parsed values win and lose their labels",
+			html:   `<html lang="en"><head><meta name="author" content="Meta Author"><meta property="article:tag" content="a"><meta property="article:tag" content="b"><meta name="keywords" content="c"></head><body><div id="zw"><p>text</p></div><div>责任编辑：李四</div></body></html>`,
+			parsed: Article{Author: "作者：王五", Editor: "（责任编辑：赵六）", OriginSource: "来源： 解放军报"},
+			want: Article{
+				Author:       "王五",
+				Editor:       "赵六",
+				OriginSource: "解放军报",
+				Tags:         []string{"a", "b"},
+				Language:     "en",
+			},
+		},
+		{
+			name: "source quoted at the start of a long body is ignored",
+			html: `<html><body><div id="zw"><p>来源：某报报道称，` + strings.Repeat("这是正文内容。", 40) + `</p></div></body></html>`,
+			want: Article{Language: "zh"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			a := tt.parsed
+			a.Content = paragraphText(doc.Find("#zw"))
+			tt.want.Content = a.Content
+			fillMetadata(doc, doc.Find("#zw"), &a)
+			if !reflect.DeepEqual(a, tt.want) {
+				t.Errorf("fillMetadata =\n%+v\nwant\n%+v", a, tt.want)
+			}
+		})
+	}
+}
+
+func TestRuleParserBackfillsByline(t *testing.T) {
+	html := `<html><body>
+<h1>标题</h1>
+<div class="info">来源：解放军报 作者：张三</div>
+<div id="zw"><p>新型装备已完成测试。</p><img src="/1.jpg"></div>
+<div class="edit">责任编辑：李四</div>
+</body></html>`
+	tests := []struct {
+		name  string
+		rules domain.ExtractionRules
+		want  [3]string
+	}{
+		{"byline only", domain.ExtractionRules{BodySelectors: []string{"#zw"}}, [3]string{"张三", "李四", "解放军报"}},
+		{"editor selector", domain.ExtractionRules{BodySelectors: []string{"#zw"}, EditorSelectors: []string{".edit"}}, [3]string{"张三", "李四", "解放军报"}},
+		{"author selector wins", domain.ExtractionRules{BodySelectors: []string{"#zw"}, AuthorSelectors: []string{"h1"}}, [3]string{"标题", "李四", "解放军报"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewRuleParser("test", tt.rules).Parse(html)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := [3]string{a.Author, a.Editor, a.OriginSource}; got != tt.want {
+				t.Errorf("author, editor, origin = %q, want %q", got, tt.want)
+			}
+			if !reflect.DeepEqual(a.Images, []string{"/1.jpg"}) || a.LeadImage != "/1.jpg" {
+				t.Errorf("Images = %v, LeadImage = %q", a.Images, a.LeadImage)
+			}
+		})
+	}
+}
+
+func TestResolveURLs(t *testing.T) {
+	a := Article{CanonicalURL: "/a.html", LeadImage: "//img.example.com/lead.jpg", Images: []string{"1.jpg", "data:image/png;base64,AA", "https://cdn.example.com/2.jpg"}}
+	a.ResolveURLs("https://news.example.com/mil/2024/index.html")
+	want := Article{
+		CanonicalURL: "https://news.example.com/a.html",
+		LeadImage:    "https://img.example.com/lead.jpg",
+		Images:       []string{"https://news.example.com/mil/2024/1.jpg", "data:image/png;base64,AA", "https://cdn.example.com/2.jpg"},
+	}
+	if !reflect.DeepEqual(a, want) {
+		t.Errorf("ResolveURLs =\n%+v\nwant\n%+v", a, want)
+	}
+}
@@ -0,0 +1,195 @@
+package content
+
+import (
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/PuerkitoBio/goquery"
+	"golang.org/x/net/html"
+)
+
+var (
+	// unlikelyNodes never hold article text.
+	unlikelyNodes = "script, style, noscript, iframe, form, nav, header, footer, aside, button, select"
+	// negativeHint / positiveHint are matched against class and id attributes.
+	negativeHint = regexp.MustCompile(`(?i)comment|footer|\bfoot\b|\bnav|menu|sidebar|related|relate|recommend|share|social|breadcrumb|copyright|banner|\bads?\b|advert|popup|\bhot\b|\brank|\btags?\b`)
+	positiveHint = regexp.MustCompile(`(?i)article|content|main|text|body|detail|story|entry|post|zw|txt`)
+)
+
+// minParagraphRunes is the shortest paragraph that counts towards a node's score.
+const minParagraphRunes = 10
+
+// ExtractMain scores the block nodes of a page by paragraph count, text density and link density
+// (in the spirit of Readability) and returns the node most likely to be the article body.
+// The document is not modified. It returns an empty selection when the page has no paragraphs.
+func ExtractMain(doc *goquery.Document) *goquery.Selection {
+	scores := map[*html.Node]float64{}
+	var order []*html.Node
+
+	addScore := func(n *html.Node, v float64) {
+		if n == nil || n.Type != html.ElementNode {
+			return
+		}
+		if _, ok := scores[n]; !ok {
+			order = append(order, n)
+		}
+		scores[n] += v
+	}
+
+	doc.Find("p, pre, td, div").Each(func(_ int, s *goquery.Selection) {
+		if s.Closest(unlikelyNodes).Length() > 0 {
+			return
+		}
+		// div 只有直接包含文本（没有块级子节点）时才当作段落
+		if goquery.NodeName(s) == "div" && s.Children().Filter("p, div, table, ul, ol, section, article").Length() > 0 {
+			return
+		}
+		text := strings.TrimSpace(s.Text())
+		n := utf8.RuneCountInString(text)
+		if n < minParagraphRunes {
+			return
+		}
+
+		score := 1.0
+		score += float64(strings.Count(text, ",") + strings.Count(text, "，") + strings.Count(text, "。"))
+		if bonus := float64(n) / 100; bonus < 3 {
+			score += bonus
+		} else {
+			score += 3
+		}
+
+		parent := s.Parent()
+		if parent.Length() == 0 {
+			return
+		}
+		addScore(parent.Get(0), score)
+		if gp := parent.Parent(); gp.Length() > 0 {
+			addScore(gp.Get(0), score/2)
+		}
+	})
+
+	var (
+		best      *html.Node
+		bestScore float64
+	)
+	for _, n := range order {
+		s := goquery.NewDocumentFromNode(n).Selection
+		if s.Closest(unlikelyNodes).Length() > 0 {
+			continue
+		}
+		score := scores[n] + classWeight(s)
+		score *= 1 - linkDensity(s)
+		if best == nil || score > bestScore {
+			best, bestScore = n, score
+		}
+	}
+	if best == nil {
+		return doc.FindNodes()
+	}
+	return doc.FindNodes(best)
+}
+
+// MainText returns the text of the node picked by ExtractMain, one paragraph per line.
+func MainText(doc *goquery.Document) string {
+	return paragraphText(ExtractMain(doc))
+}
+
+// paragraphText joins the non-empty <p> texts of s, or returns its whole text when it has none.
+func paragraphText(s *goquery.Selection) string {
+	if s.Length() == 0 {
+		return ""
+	}
+	var paragraphs []string
+	s.Find("p").Each(func(_ int, p *goquery.Selection) {
+		if p.Closest(unlikelyNodes).Length() > 0 {
+			return
+		}
+		if text := strings.TrimSpace(p.Text()); text != "" {
+			paragraphs = append(paragraphs, text)
+		}
+	})
+	if len(paragraphs) == 0 {
+		return strings.TrimSpace(s.Text())
+	}
+	return strings.Join(paragraphs, "\n")
+}
+
+func classWeight(s *goquery.Selection) float64 {
+	var w float64
+	for _, attr := range []string{"class", "id"} {
+		v, ok := s.Attr(attr)
+		if !ok || v == "" {
+			continue
+		}
+		if negativeHint.MatchString(v) {
+			w -= 25
+		}
+		if positiveHint.MatchString(v) {
+			w += 25
+		}
+	}
+	return w
+}
+
+// linkDensity is the share of a node's text that sits inside links.
+func linkDensity(s *goquery.Selection) float64 {
+	total := utf8.RuneCountInString(strings.TrimSpace(s.Text()))
+	if total == 0 {
+		return 0
+	}
+	var linked int
+	s.Find("a").Each(func(_ int, a *goquery.Selection) {
+		linked += utf8.RuneCountInString(strings.TrimSpace(a.Text()))
+	})
+	d := float64(linked) / float64(total)
+	if d > 1 {
+		d = 1
+	}
+	return d
+}
+
+// Quality compares the content found by a parser with the readability main text of the page.
+type Quality struct {
+	ParsedRunes int `json:"parsed_runes"`
+	MainRunes   int `json:"main_runes"`
+	// Coverage is the share of main-text paragraphs that also appear in the parsed content.
+	Coverage float64 `json:"coverage"`
+	// Suspicious is set when the parsed content misses most of the main text, or is much
+	// longer than it (usually navigation or "related news" blocks were pulled in).
+	Suspicious bool `json:"suspicious"`
+}
+
+// CheckQuality runs the readability extractor on html as a quality check for a site-specific parser.
+func CheckQuality(rawHTML string, a *Article) (Quality, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(rawHTML))
+	if err != nil {
+		return Quality{}, err
+	}
+	main := MainText(doc)
+
+	q := Quality{
+		ParsedRunes: utf8.RuneCountInString(a.Content),
+		MainRunes:   utf8.RuneCountInString(main),
+	}
+	if q.MainRunes == 0 {
+		return q, nil
+	}
+
+	var total, covered int
+	for _, p := range strings.Split(main, "\n") {
+		p = strings.TrimSpace(p)
+		if utf8.RuneCountInString(p) < minParagraphRunes {
+			continue
+		}
+		total++
+		if strings.Contains(a.Content, p) {
+			covered++
+		}
+	}
+	if total > 0 {
+		q.Coverage = float64(covered) / float64(total)
+	}
+	q.Suspicious = q.Coverage < 0.5 || q.ParsedRunes > 3*q.MainRunes
+	return q, nil
+}
@@ -0,0 +1,108 @@
+package content
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const articlePage = `<html><head><title>标题</title></head><body>
+<nav><p>首页，军事，国际，社会，财经，科技，体育，娱乐</p></nav>
+<div class="menu"><p>导航菜单里的一段比较长的文字，包含很多逗号，逗号，逗号。</p></div>
+<div id="detail">
+  <p>第一段正文，记者从有关部门获悉，新型装备已完成测试。</p>
+  <p>第二段正文，测试期间，各项指标均达到设计要求，运行稳定。</p>
+  <p>第三段正文，下一步将开展更大范围的训练和评估工作。</p>
+</div>
+<div class="list">
+  <p><a href="/1.html">相关新闻：另一篇很长的新闻标题，带有逗号，还有句号。</a></p>
+  <p><a href="/2.html">相关新闻：又一篇很长的新闻标题，带有逗号，还有句号。</a></p>
+  <p><a href="/3.html">相关新闻：第三篇很长的新闻标题，带有逗号，还有句号。</a></p>
+  <p><a href="/4.html">相关新闻：第四篇很长的新闻标题，带有逗号，还有句号。</a></p>
+</div>
+<footer><p>版权所有，未经授权，禁止复制，转载请注明出处。</p></footer>
+</body></html>`
+
+const mainText = "第一段正文，记者从有关部门获悉，新型装备已完成测试。\n第二段正文，测试期间，各项指标均达到设计要求，运行稳定。\n第三段正文，下一步将开展更大范围的训练和评估工作。"
+
+func TestExtractMain(t *testing.T) {
+	tests := []struct {
+		name   string
+		html   string
+		wantID string
+	}{
+		{"article over nav and link list", articlePage, "detail"},
+		{"no paragraphs", `<body><span>短</span></body>`, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			doc, err := goquery.NewDocumentFromReader(strings.NewReader(tt.html))
+			if err != nil {
+				t.Fatal(err)
+			}
+			main := ExtractMain(doc)
+			if id, _ := main.Attr("id"); id != tt.wantID {
+				t.Errorf("ExtractMain picked id=%q, want %q", id, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestExtractMainClassHint(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(`<body>
+<div class="box"><p>一段普通的文字，逗号，逗号，逗号。</p></div>
+<div class="article-content"><p>正文只有一段，但是容器名称是正文。</p></div>
+</body>`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if class, _ := ExtractMain(doc).Attr("class"); class != "article-content" {
+		t.Errorf("ExtractMain picked class=%q, want article-content", class)
+	}
+}
+
+func TestMainText(t *testing.T) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(articlePage))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := MainText(doc); got != mainText {
+		t.Errorf("MainText = %q, want %q", got, mainText)
+	}
+}
+
+func TestCheckQuality(t *testing.T) {
+	tests := []struct {
+		name           string
+		content        string
+		wantCoverage   float64
+		wantSuspicious bool
+	}{
+		{"all paragraphs", mainText, 1, false},
+		{"two of three paragraphs", strings.Join(strings.Split(mainText, "\n")[:2], "\n"), 2.0 / 3, false},
+		{"one of three paragraphs", strings.Split(mainText, "\n")[0], 1.0 / 3, true},
+		{"nothing", "", 0, true},
+		{"much longer than main text", mainText + strings.Repeat("相关新闻导航文字", 40), 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := CheckQuality(articlePage, &Article{Content: tt.content})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if diff := q.Coverage - tt.wantCoverage; diff > 1e-9 || diff < -1e-9 {
+				t.Errorf("Coverage = %v, want %v", q.Coverage, tt.wantCoverage)
+			}
+			if q.Suspicious != tt.wantSuspicious {
+				t.Errorf("Suspicious = %v, want %v (%+v)", q.Suspicious, tt.wantSuspicious, q)
+			}
+		})
+	}
+
+	// 页面没有可比较的正文时不判断
+	q, err := CheckQuality(`<body></body>`, &Article{Content: "正文"})
+	if err != nil || q.Suspicious {
+		t.Errorf("CheckQuality of an empty page = %+v, %v", q, err)
+	}
+}
@@ -1,20 +1,202 @@
 package content
 
-import "fmt"
+import (
+	"context"
+	"fmt"
+	"log"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"recommand/internal/domain"
+)
 
 var ErrUnsupportedSource = fmt.Errorf("unsupported source code")
 
-// Parse is a unified entry point for parsing different news sources by source code.
-// It routes to site-specific parsers based on sourceCode.
-func Parse(sourceCode, html string) (*Article, error) {
-	switch sourceCode {
-	case "people_military":
-		return ParsePeopleMilitary(html)
-	case "xinhua_military":
-		return ParseXinhuaMilitary(html)
-	case "gmw_military":
-		return ParseGmwMilitary(html)
-	default:
-		return nil, ErrUnsupportedSource
+// Parser extracts an Article from the HTML of one article page.
+type Parser interface {
+	Name() string
+	Parse(html string) (*Article, error)
+}
+
+// ParserFunc adapts a plain parse function to the Parser interface.
+type ParserFunc struct {
+	name string
+	fn   func(html string) (*Article, error)
+}
+
+func NewParserFunc(name string, fn func(html string) (*Article, error)) *ParserFunc {
+	return &ParserFunc{name: name, fn: fn}
+}
+
+func (p *ParserFunc) Name() string { return p.name }
+
+func (p *ParserFunc) Parse(html string) (*Article, error) { return p.fn(html) }
+
+// ParserInfo describes a registered parser, as listed by the parsers API.
+type ParserInfo struct {
+	Name        string   `json:"name"`
+	SourceCodes []string `json:"source_codes"`
+	URLPatterns []string `json:"url_patterns"`
+	Fallback    bool     `json:"fallback"`
+}
+
+type registration struct {
+	parser      Parser
+	sourceCodes []string
+	urlPatterns []*regexp.Regexp
+}
+
+// Registry resolves the parser of a page: rules stored with the source win, then the
+// parser registered for the source code, then URL patterns, and finally the fallback.
+type Registry struct {
+	mu          sync.RWMutex
+	regs        []*registration
+	bySource    map[string]Parser
+	sourceRules map[string]Parser
+	fallback    Parser
+}
+
+func NewRegistry() *Registry {
+	return &Registry{bySource: make(map[string]Parser), sourceRules: make(map[string]Parser)}
+}
+
+// DefaultRegistry holds the built-in site parsers; they register themselves in init.
+var DefaultRegistry = NewRegistry()
+
+// Register adds p for the given source codes and URL patterns (regular expressions).
+// A later registration for the same source code replaces the earlier one.
+func (r *Registry) Register(p Parser, sourceCodes []string, urlPatterns ...string) error {
+	reg := &registration{parser: p, sourceCodes: sourceCodes}
+	for _, pattern := range urlPatterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return fmt.Errorf("parser %s: invalid url pattern %q: %w", p.Name(), pattern, err)
+		}
+		reg.urlPatterns = append(reg.urlPatterns, re)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.regs = append(r.regs, reg)
+	for _, code := range sourceCodes {
+		r.bySource[code] = p
+	}
+	return nil
+}
+
+// SetSourceRules replaces all rule parsers loaded from news_sources.extraction_rules,
+// keyed by source code.
+func (r *Registry) SetSourceRules(rules map[string]domain.ExtractionRules) {
+	parsers := make(map[string]Parser, len(rules))
+	for code, rs := range rules {
+		parsers[code] = NewRuleParser("rules:"+code, rs)
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sourceRules = parsers
+}
+
+// WatchSourceRules reloads the rules stored with the sources every interval until ctx is done.
+func (r *Registry) WatchSourceRules(ctx context.Context, load func(context.Context) ([]domain.NewsSource, error), interval time.Duration, logger *log.Logger) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		sources, err := load(ctx)
+		if err != nil {
+			if logger != nil {
+				logger.Printf("load extraction rules failed: %v", err)
+			}
+		} else {
+			r.SetSourceRules(RulesFromSources(sources))
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 	}
 }
+
+// SetFallback sets the parser used for pages no registered parser claims.
+func (r *Registry) SetFallback(p Parser) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.fallback = p
+}
+
+// Resolve returns the parser for a page, or ErrUnsupportedSource when nothing matches
+// and no fallback is set.
+func (r *Registry) Resolve(sourceCode, pageURL string) (Parser, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if p, ok := r.sourceRules[sourceCode]; ok {
+		return p, nil
+	}
+	if p, ok := r.bySource[sourceCode]; ok {
+		return p, nil
+	}
+	if pageURL != "" {
+		for _, reg := range r.regs {
+			for _, re := range reg.urlPatterns {
+				if re.MatchString(pageURL) {
+					return reg.parser, nil
+				}
+			}
+		}
+	}
+	if r.fallback != nil {
+		return r.fallback, nil
+	}
+	return nil, ErrUnsupportedSource
+}
+
+// Parse resolves the parser of a page and runs it.
+func (r *Registry) Parse(sourceCode, pageURL, html string) (*Article, error) {
+	p, err := r.Resolve(sourceCode, pageURL)
+	if err != nil {
+		return nil, err
+	}
+	return p.Parse(html)
+}
+
+// List returns all registered parsers sorted by name, plus the fallback.
+func (r *Registry) List() []ParserInfo {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	res := make([]ParserInfo, 0, len(r.regs)+len(r.sourceRules)+1)
+	for code, p := range r.sourceRules {
+		res = append(res, ParserInfo{Name: p.Name(), SourceCodes: []string{code}, URLPatterns: []string{}})
+	}
+	for _, reg := range r.regs {
+		info := ParserInfo{Name: reg.parser.Name(), SourceCodes: reg.sourceCodes, URLPatterns: []string{}}
+		for _, re := range reg.urlPatterns {
+			info.URLPatterns = append(info.URLPatterns, re.String())
+		}
+		res = append(res, info)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	if r.fallback != nil {
+		res = append(res, ParserInfo{Name: r.fallback.Name(), SourceCodes: []string{}, URLPatterns: []string{}, Fallback: true})
+	}
+	return res
+}
+
+// mustRegister is used by the built-in parsers, whose patterns are known to compile.
+func mustRegister(p Parser, sourceCodes []string, urlPatterns ...string) {
+	if err := DefaultRegistry.Register(p, sourceCodes, urlPatterns...); err != nil {
+		panic(err)
+	}
+}
+
+// Parse is a unified entry point for parsing different news sources.
+// It resolves the parser through DefaultRegistry by source code, then page URL.
+func Parse(sourceCode, pageURL, html string) (*Article, error) {
+	return DefaultRegistry.Parse(sourceCode, pageURL, html)
+}
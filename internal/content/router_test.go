@@ -0,0 +1,122 @@
+package content
+
+import (
+	"errors"
+	"testing"
+
+	"recommand/internal/domain"
+)
+
+func stubParser(name string) Parser {
+	return NewParserFunc(name, func(string) (*Article, error) { return &Article{Title: name}, nil })
+}
+
+func TestRegistryResolve(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(stubParser("people"), []string{"people_military"}, `^https?://([a-z0-9-]+\.)*people\.com\.cn/`); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Register(stubParser("xinhua"), []string{"xinhua_military"}, `^https?://([a-z0-9-]+\.)*news\.cn/`); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		sourceCode string
+		pageURL    string
+		want       string
+		wantErr    error
+	}{
+		{"by source code", "people_military", "", "people", nil},
+		{"source code before url pattern", "people_military", "http://www.news.cn/mil/2024-03/05/c_1.htm", "people", nil},
+		{"by url pattern", "other", "http://military.people.com.cn/n1/2024/0305/c1011-1.html", "people", nil},
+		{"subdomain url pattern", "", "https://www.news.cn/mil/c_1.htm", "xinhua", nil},
+		{"no match without fallback", "other", "https://example.com/a.html", "", ErrUnsupportedSource},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := r.Resolve(tt.sourceCode, tt.pageURL)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Resolve err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && p.Name() != tt.want {
+				t.Errorf("Resolve(%q, %q) = %s, want %s", tt.sourceCode, tt.pageURL, p.Name(), tt.want)
+			}
+		})
+	}
+
+	r.SetFallback(stubParser("generic"))
+	p, err := r.Resolve("other", "https://example.com/a.html")
+	if err != nil || p.Name() != "generic" {
+		t.Errorf("Resolve with fallback = %v, %v; want generic", p, err)
+	}
+
+	// 同一个 source code 后注册的解析器覆盖先注册的
+	if err := r.Register(stubParser("people-v2"), []string{"people_military"}); err != nil {
+		t.Fatal(err)
+	}
+	if p, _ := r.Resolve("people_military", ""); p.Name() != "people-v2" {
+		t.Errorf("Resolve after re-register = %s, want people-v2", p.Name())
+	}
+}
+
+func TestRegistrySourceRules(t *testing.T) {
+	r := NewRegistry()
+	if err := r.Register(stubParser("people"), []string{"people_military"}, `^https?://([a-z0-9-]+\.)*people\.com\.cn/`); err != nil {
+		t.Fatal(err)
+	}
+	r.SetFallback(stubParser("generic"))
+
+	rules := domain.ExtractionRules{BodySelectors: []string{"#zw"}}
+	r.SetSourceRules(RulesFromSources([]domain.NewsSource{
+		{Code: "people_military", ExtractionRules: &rules},
+		{Code: "new_source", ExtractionRules: &rules},
+		{Code: "no_rules"},
+	}))
+
+	tests := []struct {
+		sourceCode, pageURL, want string
+	}{
+		// 数据库里的规则优先于内置解析器
+		{"people_military", "", "rules:people_military"},
+		{"new_source", "http://military.people.com.cn/n1/a.html", "rules:new_source"},
+		{"no_rules", "http://military.people.com.cn/n1/a.html", "people"},
+		{"no_rules", "https://example.com/a.html", "generic"},
+	}
+	for _, tt := range tests {
+		p, err := r.Resolve(tt.sourceCode, tt.pageURL)
+		if err != nil || p.Name() != tt.want {
+			t.Errorf("Resolve(%q, %q) = %v, %v; want %s", tt.sourceCode, tt.pageURL, p, err, tt.want)
+		}
+	}
+
+	// 重新加载时删除的规则不再生效
+	r.SetSourceRules(nil)
+	if p, _ := r.Resolve("people_military", ""); p.Name() != "people" {
+		t.Errorf("Resolve after rules were removed = %s, want people", p.Name())
+	}
+}
+
+func TestRegistryRejectsInvalidPattern(t *testing.T) {
+	if err := NewRegistry().Register(stubParser("bad"), nil, `(`); err == nil {
+		t.Error("Register accepted an invalid url pattern")
+	}
+}
+
+func TestDefaultRegistry(t *testing.T) {
+	tests := []struct {
+		sourceCode, pageURL, want string
+	}{
+		{"people_military", "", "people"},
+		{"xinhua_military", "", "xinhua"},
+		{"gmw_military", "", "gmw"},
+		{"", "https://mil.gmw.cn/2024-03/05/content_1.htm", "gmw"},
+		{"unknown", "https://example.com/a.html", "generic"},
+	}
+	for _, tt := range tests {
+		p, err := DefaultRegistry.Resolve(tt.sourceCode, tt.pageURL)
+		if err != nil || p.Name() != tt.want {
+			t.Errorf("DefaultRegistry.Resolve(%q, %q) = %v, %v; want %s", tt.sourceCode, tt.pageURL, p, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package content
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+
+	"recommand/internal/domain"
+)
+
+// defaultDateLayouts are tried when a rule set does not list its own layouts.
+var defaultDateLayouts = []string{
+	"2006-01-02 15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+	"2006年01月02日 15:04",
+	"2006年01月02日15:04",
+	"2006年01月02日",
+}
+
+// RuleParser is a generic parser driven by declarative extraction rules,
+// either built in (see people.go, xinhua.go, gmw.go) or stored with a source.
+type RuleParser struct {
+	name  string
+	rules domain.ExtractionRules
+}
+
+func NewRuleParser(name string, rules domain.ExtractionRules) *RuleParser {
+	return &RuleParser{name: name, rules: rules}
+}
+
+func (p *RuleParser) Name() string { return p.name }
+
+// Rules returns the extraction rules the parser runs.
+func (p *RuleParser) Rules() domain.ExtractionRules { return p.rules }
+
+func (p *RuleParser) Parse(html string) (*Article, error) {
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sel := range p.rules.RemoveSelectors {
+		doc.Find(sel).Remove()
+	}
+
+	var a Article
+
+	// 标题：规则里的选择器优先，然后是 h1 和网页 title
+	for _, sel := range append(append([]string{}, p.rules.TitleSelectors...), "h1", "title") {
+		if text := selectionText(doc.Find(sel).First()); text != "" {
+			a.Title = text
+			break
+		}
+	}
+
+	// 正文：优先拼接段落文本，避免把页面上所有导航/脚注一起抓进来
+	var body *goquery.Selection
+	for _, sel := range p.rules.BodySelectors {
+		selection := doc.Find(sel)
+		if selection.Length() == 0 {
+			continue
+		}
+		var paragraphs []string
+		selection.Find("p").Each(func(_ int, s *goquery.Selection) {
+			text := strings.TrimSpace(s.Text())
+			if text != "" {
+				paragraphs = append(paragraphs, text)
+			}
+		})
+		if len(paragraphs) == 0 {
+			// 退化为容器整体文本
+			text := strings.TrimSpace(selection.Text())
+			if text == "" {
+				continue
+			}
+			a.Content = text
+		} else {
+			a.Content = strings.Join(paragraphs, "\n")
+		}
+		body = selection
+		break
+	}
+	if a.Content == "" {
+		// 选择器都没命中时，用 readability 找正文节点，而不是整个 body
+		body = ExtractMain(doc)
+		a.Content = paragraphText(body)
+	}
+
+	// 发布时间：规则里的选择器（先按 layout 精确解析，再在文本中查找日期），然后是 meta / JSON-LD
+	now := time.Now()
+	layouts := p.rules.DateLayouts
+	if len(layouts) == 0 {
+		layouts = defaultDateLayouts
+	}
+	for _, sel := range p.rules.PublishTimeSelectors {
+		if t, ok := ParseDate(selectionText(doc.Find(sel).First()), layouts, now); ok {
+			a.PublishTime = t
+			break
+		}
+	}
+	if a.PublishTime.IsZero() {
+		if t, ok := ExtractPublishTime(doc, now); ok {
+			a.PublishTime = t
+		}
+	}
+
+	a.Author = firstText(doc, p.rules.AuthorSelectors)
+	a.Editor = firstText(doc, p.rules.EditorSelectors)
+	a.OriginSource = firstText(doc, p.rules.OriginSelectors)
+	for _, sel := range p.rules.ImageSelectors {
+		doc.Find(sel).Each(func(_ int, s *goquery.Selection) {
+			if goquery.NodeName(s) != "img" {
+				s = s.Find("img")
+			}
+			s.Each(func(_ int, img *goquery.Selection) {
+				if src := imageSource(img); src != "" {
+					a.Images = append(a.Images, src)
+				}
+			})
+		})
+		if len(a.Images) > 0 {
+			break
+		}
+	}
+
+	// 规则没有覆盖的字段从 meta 标签和署名行中补全
+	fillMetadata(doc, body, &a)
+
+	return &a, nil
+}
+
+// selectionText returns the trimmed text of s; for <meta> elements it returns the content attribute.
+func selectionText(s *goquery.Selection) string {
+	if s.Length() == 0 {
+		return ""
+	}
+	if goquery.NodeName(s) == "meta" {
+		v, _ := s.Attr("content")
+		return strings.TrimSpace(v)
+	}
+	return strings.TrimSpace(s.Text())
+}
+
+// firstText returns the text of the first selector that matches a non-empty element.
+func firstText(doc *goquery.Document, selectors []string) string {
+	for _, sel := range selectors {
+		if text := selectionText(doc.Find(sel).First()); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+// ValidateRules checks that every selector of the rule set compiles.
+func ValidateRules(rules domain.ExtractionRules) error {
+	groups := map[string][]string{
+		"title_selectors":        rules.TitleSelectors,
+		"body_selectors":         rules.BodySelectors,
+		"publish_time_selectors": rules.PublishTimeSelectors,
+		"author_selectors":       rules.AuthorSelectors,
+		"editor_selectors":       rules.EditorSelectors,
+		"origin_selectors":       rules.OriginSelectors,
+		"image_selectors":        rules.ImageSelectors,
+		"remove_selectors":       rules.RemoveSelectors,
+	}
+	for field, selectors := range groups {
+		for _, sel := range selectors {
+			if _, err := cascadia.Compile(sel); err != nil {
+				return fmt.Errorf("%s: invalid selector %q: %v", field, sel, err)
+			}
+		}
+	}
+	return nil
+}
+
+// RulesFromSources collects the extraction rules stored with sources, keyed by source code.
+// Disabled sources keep their rules so already crawled pages can still be parsed.
+func RulesFromSources(sources []domain.NewsSource) map[string]domain.ExtractionRules {
+	res := make(map[string]domain.ExtractionRules)
+	for _, src := range sources {
+		if src.ExtractionRules != nil {
+			res[src.Code] = *src.ExtractionRules
+		}
+	}
+	return res
+}
@@ -0,0 +1,134 @@
+package content
+
+import (
+	"strings"
+	"testing"
+
+	"recommand/internal/domain"
+)
+
+const rulesPage = `<html><head><title>页面标题 - 新闻网</title></head><body>
+<div class="nav"><p>首页 | 军事 | 国际</p></div>
+<h1>一级标题</h1>
+<h2 class="headline">规则标题</h2>
+<div class="info"><span class="time">2024-03-05 08:12</span><span class="author">张三</span></div>
+<div id="empty"></div>
+<div id="zw"><p>第一段正文。</p><p></p><p>第二段正文。</p></div>
+<div class="article">备用容器里的全部文字</div>
+<div class="ad">广告</div>
+</body></html>`
+
+func TestRuleParserSelectors(t *testing.T) {
+	tests := []struct {
+		name        string
+		rules       domain.ExtractionRules
+		wantTitle   string
+		wantContent string
+		wantTime    string
+		wantAuthor  string
+	}{
+		{
+			name:        "rule selectors win",
+			rules:       domain.ExtractionRules{TitleSelectors: []string{".headline"}, BodySelectors: []string{"#zw"}, PublishTimeSelectors: []string{".time"}, AuthorSelectors: []string{".author"}},
+			wantTitle:   "规则标题",
+			wantContent: "第一段正文。\n第二段正文。",
+			wantTime:    "2024-03-05 08:12",
+			wantAuthor:  "张三",
+		},
+		{
+			name:        "title falls back to h1",
+			rules:       domain.ExtractionRules{TitleSelectors: []string{".missing"}, BodySelectors: []string{"#zw"}},
+			wantTitle:   "一级标题",
+			wantContent: "第一段正文。\n第二段正文。",
+		},
+		{
+			name:        "first matching body selector wins",
+			rules:       domain.ExtractionRules{BodySelectors: []string{".missing", "#empty", "#zw", ".article"}},
+			wantTitle:   "一级标题",
+			wantContent: "第一段正文。\n第二段正文。",
+		},
+		{
+			name:        "container text without paragraphs",
+			rules:       domain.ExtractionRules{BodySelectors: []string{".article", "#zw"}},
+			wantTitle:   "一级标题",
+			wantContent: "备用容器里的全部文字",
+		},
+		{
+			name:        "time with custom layout",
+			rules:       domain.ExtractionRules{BodySelectors: []string{"#zw"}, PublishTimeSelectors: []string{".missing", ".time"}, DateLayouts: []string{"2006-01-02 15:04"}},
+			wantTitle:   "一级标题",
+			wantContent: "第一段正文。\n第二段正文。",
+			wantTime:    "2024-03-05 08:12",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a, err := NewRuleParser("test", tt.rules).Parse(rulesPage)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if a.Title != tt.wantTitle {
+				t.Errorf("Title = %q, want %q", a.Title, tt.wantTitle)
+			}
+			if a.Content != tt.wantContent {
+				t.Errorf("Content = %q, want %q", a.Content, tt.wantContent)
+			}
+			if tt.wantTime != "" && a.PublishTime.Format("2006-01-02 15:04") != tt.wantTime {
+				t.Errorf("PublishTime = %s, want %s", a.PublishTime, tt.wantTime)
+			}
+			if tt.wantAuthor != "" && a.Author != tt.wantAuthor {
+				t.Errorf("Author = %q, want %q", a.Author, tt.wantAuthor)
+			}
+		})
+	}
+}
+
+func TestRuleParserFallsBackToReadability(t *testing.T) {
+	a, err := NewRuleParser("test", domain.ExtractionRules{BodySelectors: []string{".missing", "#empty"}}).Parse(articlePage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Content != mainText {
+		t.Errorf("Content = %q, want the readability main text %q", a.Content, mainText)
+	}
+}
+
+func TestRuleParserRemoveSelectors(t *testing.T) {
+	rules := domain.ExtractionRules{BodySelectors: []string{"body"}, RemoveSelectors: []string{".nav", ".ad", ".article"}}
+	a, err := NewRuleParser("test", rules).Parse(rulesPage)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, removed := range []string{"首页", "广告", "备用容器"} {
+		if strings.Contains(a.Content, removed) {
+			t.Errorf("Content %q contains removed text %q", a.Content, removed)
+		}
+	}
+}
+
+func TestValidateRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   domain.ExtractionRules
+		wantErr string
+	}{
+		{"empty rules", domain.ExtractionRules{}, ""},
+		{"valid selectors", domain.ExtractionRules{TitleSelectors: []string{"h1.title", `meta[property="og:title"]`}, BodySelectors: []string{"#zw > p"}}, ""},
+		{"bad body selector", domain.ExtractionRules{BodySelectors: []string{"#zw", "div[class="}}, "body_selectors"},
+		{"bad remove selector", domain.ExtractionRules{RemoveSelectors: []string{">>"}}, "remove_selectors"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRules(tt.rules)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Errorf("ValidateRules = %v, want nil", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("ValidateRules = %v, want an error about %s", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,40 @@
+package crawler
+
+import (
+	"bytes"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding/simplifiedchinese"
+)
+
+// toUTF8 converts an HTML body to UTF-8 and returns the charset it was decoded from.
+// The charset is taken from a BOM, the Content-Type header or <meta charset>; when none
+// of them declares one the bytes are sniffed: valid UTF-8 stays as is, anything else is
+// read as GB18030, the superset of the GBK/GB2312 pages served by older Chinese news sites.
+func toUTF8(body []byte, contentType string) ([]byte, string, error) {
+	enc, name, certain := charset.DetermineEncoding(body, contentType)
+	// <meta charset> 的预扫描结果总是 certain=false；没有任何声明时得到的是
+	// windows-1252（或按字节猜出的 utf-8），只有这两种情况才自己判断
+	if !certain && (name == "windows-1252" || name == "utf-8") {
+		if utf8.Valid(body) {
+			return body, "utf-8", nil
+		}
+		enc, name = simplifiedchinese.GB18030, "gb18030"
+	}
+
+	name = strings.ToLower(name)
+	if name == "utf-8" {
+		return bytes.TrimPrefix(body, []byte("\xef\xbb\xbf")), name, nil
+	}
+	// GB2312/GBK 声明的页面里经常混有 GB18030 才有的字符，统一用 GB18030 解码
+	if name == "gbk" || name == "gb2312" {
+		enc = simplifiedchinese.GB18030
+	}
+	out, err := enc.NewDecoder().Bytes(body)
+	if err != nil {
+		return nil, name, err
+	}
+	return out, name, nil
+}
@@ -0,0 +1,56 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/traditionalchinese"
+)
+
+func encode(t *testing.T, enc encoding.Encoding, s string) []byte {
+	t.Helper()
+	b, err := enc.NewEncoder().Bytes([]byte(s))
+	if err != nil {
+		t.Fatalf("encode %q: %v", s, err)
+	}
+	return b
+}
+
+func TestToUTF8(t *testing.T) {
+	const text = "中文新聞"
+	page := func(meta string) string {
+		return "<html><head>" + meta + "</head><body>" + text + "</body></html>"
+	}
+
+	tests := []struct {
+		name        string
+		body        []byte
+		contentType string
+		wantCharset string
+	}{
+		{"utf-8 without declaration", []byte(page("")), "text/html", "utf-8"},
+		{"utf-8 with bom", append([]byte("\xef\xbb\xbf"), page("")...), "", "utf-8"},
+		{"utf-8 meta", []byte(page(`<meta charset="utf-8">`)), "", "utf-8"},
+		{"gbk header", encode(t, simplifiedchinese.GBK, page("")), "text/html; charset=gbk", "gbk"},
+		{"gb2312 meta", encode(t, simplifiedchinese.GBK, page(`<meta http-equiv="Content-Type" content="text/html; charset=gb2312">`)), "text/html", "gbk"},
+		{"big5 meta", encode(t, traditionalchinese.Big5, page(`<meta charset="big5">`)), "text/html", "big5"},
+		{"gbk without declaration", encode(t, simplifiedchinese.GBK, page("")), "text/html", "gb18030"},
+		{"header wins over meta", encode(t, traditionalchinese.Big5, page(`<meta charset="gbk">`)), "text/html; charset=big5", "big5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, cs, err := toUTF8(tt.body, tt.contentType)
+			if err != nil {
+				t.Fatalf("toUTF8: %v", err)
+			}
+			if cs != tt.wantCharset {
+				t.Errorf("charset = %q, want %q", cs, tt.wantCharset)
+			}
+			if !strings.Contains(string(got), text) {
+				t.Errorf("body = %q, want it to contain %q", got, text)
+			}
+		})
+	}
+}
@@ -0,0 +1,357 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+
+	"recommand/internal/content"
+	"recommand/internal/domain"
+	"recommand/internal/repository"
+)
+
+// discoveryPlan is the resolved discovery settings of a source.
+type discoveryPlan struct {
+	method   string
+	urls     []string
+	patterns []*regexp.Regexp
+}
+
+// planDiscovery resolves a source's discovery settings: HTML list pages starting at BaseURL by default.
+func planDiscovery(source *domain.NewsSource) (discoveryPlan, error) {
+	plan := discoveryPlan{method: domain.DiscoveryHTML, urls: []string{source.BaseURL}}
+	d := source.Discovery
+	if d == nil {
+		return plan, nil
+	}
+	if d.Method != "" {
+		plan.method = d.Method
+	}
+	if len(d.URLs) > 0 {
+		plan.urls = d.URLs
+	}
+	patterns, err := compileLinkPatterns(d.LinkPatterns)
+	if err != nil {
+		return plan, err
+	}
+	plan.patterns = patterns
+	return plan, nil
+}
+
+// ValidateDiscovery checks the discovery settings of a source before they are stored.
+func ValidateDiscovery(d domain.Discovery) error {
+	switch d.Method {
+	case "", domain.DiscoveryHTML, domain.DiscoveryFeed, domain.DiscoverySitemap:
+	default:
+		return fmt.Errorf("discovery.method: unknown method %q", d.Method)
+	}
+	for _, raw := range d.URLs {
+		u, err := url.Parse(raw)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("discovery.urls: invalid url %q", raw)
+		}
+	}
+	if _, err := compileLinkPatterns(d.LinkPatterns); err != nil {
+		return err
+	}
+	return nil
+}
+
+func compileLinkPatterns(patterns []string) ([]*regexp.Regexp, error) {
+	var res []*regexp.Regexp
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("discovery.link_patterns: invalid pattern %q: %v", p, err)
+		}
+		res = append(res, re)
+	}
+	return res, nil
+}
+
+// matchesAny reports whether link matches one of the patterns.
+func matchesAny(patterns []*regexp.Regexp, link string) bool {
+	for _, re := range patterns {
+		if re.MatchString(link) {
+			return true
+		}
+	}
+	return false
+}
+
+// filterLinks keeps the links matching one of the patterns; without patterns all links are kept.
+func filterLinks(patterns []*regexp.Regexp, links []articleLink) []articleLink {
+	if len(patterns) == 0 {
+		return links
+	}
+	var kept []articleLink
+	for _, l := range links {
+		if matchesAny(patterns, l.URL) {
+			kept = append(kept, l)
+		}
+	}
+	return kept
+}
+
+// frontier is the URL frontier of one task. It is persisted in crawl_frontier so that
+// a task adopted after a restart resumes where it was interrupted.
+type frontier struct {
+	repo   *repository.FrontierRepo
+	taskID string
+	seen   map[string]struct{}
+}
+
+func newFrontier(repo *repository.FrontierRepo, taskID string) *frontier {
+	return &frontier{repo: repo, taskID: taskID, seen: make(map[string]struct{})}
+}
+
+// load reads the persisted frontier of the task.
+func (f *frontier) load(ctx context.Context) ([]domain.FrontierEntry, error) {
+	entries, err := f.repo.List(ctx, f.taskID)
+	if err != nil {
+		return nil, err
+	}
+	for _, en := range entries {
+		f.seen[en.URL] = struct{}{}
+	}
+	return entries, nil
+}
+
+// unseen returns the links that are not in the frontier yet, de-duplicated.
+func (f *frontier) unseen(links []articleLink) []articleLink {
+	var res []articleLink
+	batch := map[string]struct{}{}
+	for _, l := range links {
+		if _, ok := f.seen[l.URL]; ok {
+			continue
+		}
+		if _, ok := batch[l.URL]; ok {
+			continue
+		}
+		batch[l.URL] = struct{}{}
+		res = append(res, l)
+	}
+	return res
+}
+
+// unseenURLs is unseen for plain URLs.
+func (f *frontier) unseenURLs(urls []string) []string {
+	var res []string
+	for _, u := range urls {
+		if _, ok := f.seen[u]; !ok {
+			res = append(res, u)
+		}
+	}
+	return res
+}
+
+// add persists entries of one kind and depth and marks their URLs as seen.
+func (f *frontier) add(ctx context.Context, kind string, depth int, listURL string, entries []domain.FrontierEntry) error {
+	if err := f.repo.Add(ctx, f.taskID, kind, depth, listURL, entries); err != nil {
+		return err
+	}
+	for _, en := range entries {
+		f.seen[en.URL] = struct{}{}
+	}
+	return nil
+}
+
+// feed covers RSS 2.0, RSS 1.0 (RDF) and Atom documents.
+type feed struct {
+	Items   []feedItem  `xml:"channel>item"`
+	RDF     []feedItem  `xml:"item"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type feedItem struct {
+	Title   string `xml:"title"`
+	Link    string `xml:"link"`
+	GUID    string `xml:"guid"`
+	PubDate string `xml:"pubDate"`
+	Date    string `xml:"http://purl.org/dc/elements/1.1/ date"`
+}
+
+type atomEntry struct {
+	Title     string     `xml:"title"`
+	Links     []atomLink `xml:"link"`
+	Published string     `xml:"published"`
+	Updated   string     `xml:"updated"`
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+}
+
+// parseFeed returns the article links of an RSS or Atom feed, resolved against base.
+func parseFeed(body []byte, base *url.URL) ([]articleLink, error) {
+	var f feed
+	if err := decodeXML(body, &f); err != nil {
+		return nil, fmt.Errorf("parse feed: %w", err)
+	}
+
+	var links []articleLink
+	add := func(href, title, date string) {
+		u := resolveLink(base, href)
+		if u == nil {
+			return
+		}
+		l := articleLink{URL: u.String(), Anchor: strings.TrimSpace(title)}
+		l.ListedAt, l.DateOnly = parseFeedDate(date)
+		links = append(links, l)
+	}
+	for _, it := range append(f.Items, f.RDF...) {
+		href := strings.TrimSpace(it.Link)
+		if href == "" && isHTTPURL(it.GUID) {
+			href = strings.TrimSpace(it.GUID)
+		}
+		date := it.PubDate
+		if date == "" {
+			date = it.Date
+		}
+		add(href, it.Title, date)
+	}
+	for _, e := range f.Entries {
+		var href string
+		for _, l := range e.Links {
+			if l.Rel == "" || l.Rel == "alternate" {
+				href = l.Href
+				break
+			}
+		}
+		date := e.Published
+		if date == "" {
+			date = e.Updated
+		}
+		add(href, e.Title, date)
+	}
+	return links, nil
+}
+
+// sitemap covers <urlset> (including Google news sitemaps) and <sitemapindex> documents.
+type sitemap struct {
+	URLs     []sitemapURL   `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+type sitemapURL struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+	News    struct {
+		Title           string `xml:"title"`
+		PublicationDate string `xml:"publication_date"`
+	} `xml:"news"`
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapChild is a sitemap listed by a sitemap index.
+type sitemapChild struct {
+	URL     string
+	LastMod time.Time
+}
+
+// parseSitemap returns the article links of a sitemap, or the child sitemaps of a sitemap index.
+// Gzip-compressed sitemaps (.xml.gz) are decompressed up to maxBytes (no limit when <= 0);
+// larger ones return ErrResponseTooLarge.
+func parseSitemap(body []byte, base *url.URL, maxBytes int64) ([]articleLink, []sitemapChild, error) {
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, nil, fmt.Errorf("gunzip sitemap: %w", err)
+		}
+		var r io.Reader = zr
+		if maxBytes > 0 {
+			r = io.LimitReader(zr, maxBytes+1)
+		}
+		if body, err = io.ReadAll(r); err != nil {
+			return nil, nil, fmt.Errorf("gunzip sitemap: %w", err)
+		}
+		if maxBytes > 0 && int64(len(body)) > maxBytes {
+			return nil, nil, fmt.Errorf("gunzip sitemap: %w: more than %d bytes", ErrResponseTooLarge, maxBytes)
+		}
+	}
+
+	var sm sitemap
+	if err := decodeXML(body, &sm); err != nil {
+		return nil, nil, fmt.Errorf("parse sitemap: %w", err)
+	}
+
+	var (
+		links    []articleLink
+		children []sitemapChild
+	)
+	for _, s := range sm.Sitemaps {
+		if u := resolveLink(base, s.Loc); u != nil {
+			lastMod, _ := parseFeedDate(s.LastMod)
+			children = append(children, sitemapChild{URL: u.String(), LastMod: lastMod})
+		}
+	}
+	for _, entry := range sm.URLs {
+		u := resolveLink(base, entry.Loc)
+		if u == nil {
+			continue
+		}
+		l := articleLink{URL: u.String(), Anchor: strings.TrimSpace(entry.News.Title)}
+		// 新闻 sitemap 的发布时间比 lastmod 更准确
+		date := entry.News.PublicationDate
+		if date == "" {
+			date = entry.LastMod
+		}
+		l.ListedAt, l.DateOnly = parseFeedDate(date)
+		links = append(links, l)
+	}
+	return links, children, nil
+}
+
+// decodeXML decodes an XML document in any charset declared by its prolog (e.g. GBK feeds).
+func decodeXML(body []byte, v any) error {
+	dec := xml.NewDecoder(bytes.NewReader(body))
+	dec.CharsetReader = charset.NewReaderLabel
+	dec.Strict = false
+	return dec.Decode(v)
+}
+
+// feedDateLayouts are the date formats of RSS (RFC 822 and its common variants) and Atom.
+var feedDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	time.RFC3339,
+}
+
+// parseFeedDate parses a feed or sitemap date; dateOnly is set for W3C dates without a time ("2024-03-05").
+func parseFeedDate(s string) (t time.Time, dateOnly bool) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, false
+	}
+	for _, layout := range feedDateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t, false
+		}
+	}
+	if m, ok := content.FindDate(s, time.Now()); ok {
+		return m.Time, !m.HasClock
+	}
+	return time.Time{}, false
+}
+
+func isHTTPURL(s string) bool {
+	s = strings.TrimSpace(s)
+	return strings.HasPrefix(s, "http://") || strings.HasPrefix(s, "https://")
+}
@@ -0,0 +1,157 @@
+package crawler
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func mustURL(t *testing.T, s string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func gzipped(t *testing.T, s string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(s)); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestParseFeed(t *testing.T) {
+	base := mustURL(t, "https://news.example.com/rss/")
+	tests := []struct {
+		name      string
+		body      string
+		wantURLs  []string
+		wantFirst time.Time
+	}{
+		{
+			name: "rss 2.0 with relative link and guid fallback",
+			body: `<?xml version="1.0"?><rss version="2.0"><channel>
+<item><title> 第一篇 </title><link>/2024/0305/a.html</link><pubDate>Tue, 05 Mar 2024 08:00:00 +0800</pubDate></item>
+<item><title>第二篇</title><guid>https://news.example.com/2024/0305/b.html</guid></item>
+<item><title>no link</title><guid isPermaLink="false">abc-123</guid></item>
+</channel></rss>`,
+			wantURLs:  []string{"https://news.example.com/2024/0305/a.html", "https://news.example.com/2024/0305/b.html"},
+			wantFirst: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "rss 1.0 with dc:date",
+			body: `<?xml version="1.0"?><rdf:RDF xmlns:rdf="http://www.w3.org/1999/02/22-rdf-syntax-ns#" xmlns="http://purl.org/rss/1.0/" xmlns:dc="http://purl.org/dc/elements/1.1/">
+<item><title>a</title><link>https://news.example.com/a.html</link><dc:date>2024-03-05T00:00:00Z</dc:date></item>
+</rdf:RDF>`,
+			wantURLs:  []string{"https://news.example.com/a.html"},
+			wantFirst: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name: "atom prefers the alternate link",
+			body: `<?xml version="1.0"?><feed xmlns="http://www.w3.org/2005/Atom">
+<entry><title>a</title><link rel="self" href="https://news.example.com/self"/><link rel="alternate" href="/a.html"/><updated>2024-03-05T00:00:00Z</updated></entry>
+</feed>`,
+			wantURLs:  []string{"https://news.example.com/a.html"},
+			wantFirst: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			links, err := parseFeed([]byte(tt.body), base)
+			if err != nil {
+				t.Fatalf("parseFeed: %v", err)
+			}
+			var got []string
+			for _, l := range links {
+				got = append(got, l.URL)
+			}
+			if strings.Join(got, " ") != strings.Join(tt.wantURLs, " ") {
+				t.Fatalf("urls = %v, want %v", got, tt.wantURLs)
+			}
+			if !links[0].ListedAt.Equal(tt.wantFirst) {
+				t.Errorf("listed at = %s, want %s", links[0].ListedAt, tt.wantFirst)
+			}
+		})
+	}
+
+	if _, err := parseFeed([]byte("not xml at all <"), base); err == nil {
+		t.Error("parseFeed accepted a broken document")
+	}
+}
+
+func TestParseSitemap(t *testing.T) {
+	base := mustURL(t, "https://news.example.com/sitemap.xml")
+	const urlset = `<?xml version="1.0"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9" xmlns:news="http://www.google.com/schemas/sitemap-news/0.9">
+<url><loc>https://news.example.com/a.html</loc><lastmod>2024-03-01</lastmod>
+<news:news><news:title>标题</news:title><news:publication_date>2024-03-05T08:00:00+08:00</news:publication_date></news:news></url>
+<url><loc>https://news.example.com/b.html</loc><lastmod>2024-03-04</lastmod></url>
+</urlset>`
+	const index = `<?xml version="1.0"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>/sitemap-2024-03.xml.gz</loc><lastmod>2024-03-05T00:00:00Z</lastmod></sitemap>
+<sitemap><loc>https://news.example.com/sitemap-2024-02.xml</loc></sitemap>
+</sitemapindex>`
+
+	t.Run("urlset", func(t *testing.T) {
+		links, children, err := parseSitemap([]byte(urlset), base, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(children) != 0 || len(links) != 2 {
+			t.Fatalf("got %d links, %d children", len(links), len(children))
+		}
+		if links[0].Anchor != "标题" || !links[0].ListedAt.Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)) || links[0].DateOnly {
+			t.Errorf("news sitemap entry = %+v", links[0])
+		}
+		if !links[1].DateOnly {
+			t.Errorf("lastmod without time should be date-only: %+v", links[1])
+		}
+	})
+
+	t.Run("index", func(t *testing.T) {
+		links, children, err := parseSitemap([]byte(index), base, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 0 || len(children) != 2 {
+			t.Fatalf("got %d links, %d children", len(links), len(children))
+		}
+		if children[0].URL != "https://news.example.com/sitemap-2024-03.xml.gz" || children[0].LastMod.IsZero() {
+			t.Errorf("child = %+v", children[0])
+		}
+		if !children[1].LastMod.IsZero() {
+			t.Errorf("child without lastmod = %+v", children[1])
+		}
+	})
+
+	t.Run("gzip", func(t *testing.T) {
+		links, _, err := parseSitemap(gzipped(t, urlset), base, 1<<20)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(links) != 2 {
+			t.Fatalf("got %d links", len(links))
+		}
+	})
+
+	t.Run("gzip larger than the body limit", func(t *testing.T) {
+		bomb := gzipped(t, urlset+strings.Repeat(" ", 1<<20))
+		_, _, err := parseSitemap(bomb, base, 64<<10)
+		if !errors.Is(err, ErrResponseTooLarge) {
+			t.Fatalf("err = %v, want ErrResponseTooLarge", err)
+		}
+	})
+}
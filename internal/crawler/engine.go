@@ -1,122 +1,1009 @@
 package crawler
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
-	"io"
+	"errors"
+	"fmt"
 	"log"
-	"net/http"
+	"net/url"
+	"sync"
 	"time"
 
+	"github.com/PuerkitoBio/goquery"
+	kafkago "github.com/segmentio/kafka-go"
+
+	"recommand/internal/blob"
+	"recommand/internal/config"
 	"recommand/internal/domain"
 	"recommand/internal/kafka"
+	"recommand/internal/pipeline"
 	"recommand/internal/repository"
 )
 
-// Engine is a very simple fake crawler engine that simulates task progress.
+// DefaultMaxPages is the number of list pages walked when a task does not set max_pages.
+const DefaultMaxPages = 10
+
+// ProducerName is the producer recorded in the envelope of news.raw messages.
+const ProducerName = "crawler-service"
+
+// maxFetchAttempts is how often an article interrupted by restarts is tried before it is given up.
+const maxFetchAttempts = 3
+
+var (
+	// ErrTaskStopped is the cancel cause of a task stopped through Engine.Stop.
+	ErrTaskStopped = errors.New("task stopped")
+	// ErrEngineShutdown is the cancel cause of the tasks interrupted by Engine.Shutdown.
+	ErrEngineShutdown = errors.New("engine shutting down")
+)
+
+// Engine runs crawl tasks: it discovers article links from a source's list pages, feeds
+// or sitemaps, and publishes the fetched article pages into news.raw.
 type Engine struct {
-	taskRepo   *repository.TaskRepo
-	sourceRepo *repository.SourceRepo
-	writer     *kafka.Writer
-	logger     *log.Logger
+	taskRepo     *repository.TaskRepo
+	sourceRepo   *repository.SourceRepo
+	newsRepo     *repository.NewsRepo
+	frontierRepo *repository.FrontierRepo
+	writer       *kafka.Writer
+	fetcher      *Fetcher
+	store        blob.Store
+	packOpts     blob.PackOptions
+	// staleAfter is how long a task may go without heartbeat before it counts as orphaned.
+	staleAfter time.Duration
+	// parseTimeout is how long a task in awaiting_parse may see no pipeline progress before it completes anyway.
+	parseTimeout   time.Duration
+	maxErrorRate   float64
+	minErrorSample int
+	logger         *log.Logger
+
+	mu      sync.Mutex
+	running map[string]context.CancelCauseFunc
+	wg      sync.WaitGroup
 }
 
-func NewEngine(taskRepo *repository.TaskRepo, sourceRepo *repository.SourceRepo, writer *kafka.Writer, logger *log.Logger) *Engine {
-	return &Engine{taskRepo: taskRepo, sourceRepo: sourceRepo, writer: writer, logger: logger}
+func NewEngine(taskRepo *repository.TaskRepo, sourceRepo *repository.SourceRepo, newsRepo *repository.NewsRepo, frontierRepo *repository.FrontierRepo, writer *kafka.Writer, fetcher *Fetcher, store blob.Store, packOpts blob.PackOptions, cfg config.CrawlerConfig, logger *log.Logger) *Engine {
+	return &Engine{
+		taskRepo:       taskRepo,
+		sourceRepo:     sourceRepo,
+		newsRepo:       newsRepo,
+		frontierRepo:   frontierRepo,
+		staleAfter:     cfg.TaskStaleAfter,
+		parseTimeout:   cfg.ParseTimeout,
+		maxErrorRate:   cfg.MaxErrorRate,
+		minErrorSample: cfg.MinErrorSample,
+		writer:         writer,
+		fetcher:        fetcher,
+		store:          store,
+		packOpts:       packOpts,
+		logger:         logger,
+		running:        make(map[string]context.CancelCauseFunc),
+	}
 }
 
-// StartFakeTask runs a fake crawl in background, updating status/progress in DB.
-// It uses a background context so it is not tied to any single HTTP request lifecycle.
-func (e *Engine) StartFakeTask(taskID string) {
+// StartTask runs a crawl in background, updating status/progress in DB.
+// It uses a background context so it is not tied to any single HTTP request lifecycle;
+// the task can be cancelled later through Stop.
+func (e *Engine) StartTask(taskID string) {
+	ctx, cancel := context.WithCancelCause(context.Background())
+
+	e.mu.Lock()
+	if _, ok := e.running[taskID]; ok {
+		e.mu.Unlock()
+		cancel(nil)
+		e.logf("task %s: already running", taskID)
+		return
+	}
+	e.running[taskID] = cancel
+	e.wg.Add(1)
+	e.mu.Unlock()
+
 	go func() {
-		ctx := context.Background()
+		defer e.wg.Done()
+		defer func() {
+			e.mu.Lock()
+			delete(e.running, taskID)
+			e.mu.Unlock()
+			cancel(nil)
+		}()
+		e.run(ctx, taskID)
+	}()
+}
+
+// Stop cancels a running task: in-flight HTTP fetches and Kafka writes are aborted.
+// The caller is responsible for recording the stopped status. It reports whether
+// the task was running in this engine.
+func (e *Engine) Stop(taskID string) bool {
+	e.mu.Lock()
+	cancel, ok := e.running[taskID]
+	e.mu.Unlock()
+	if ok {
+		cancel(ErrTaskStopped)
+	}
+	return ok
+}
+
+// Shutdown interrupts all running tasks and waits until they returned. Their status is left
+// as is, so another engine (or this one after a restart) adopts them from their checkpoint.
+func (e *Engine) Shutdown() {
+	e.mu.Lock()
+	for _, cancel := range e.running {
+		cancel(ErrEngineShutdown)
+	}
+	e.mu.Unlock()
+	e.wg.Wait()
+}
+
+// IsRunning reports whether the task is currently executed by this engine.
+func (e *Engine) IsRunning(taskID string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	_, ok := e.running[taskID]
+	return ok
+}
+
+func (e *Engine) run(ctx context.Context, taskID string) {
+	e.logf("task %s: begin", taskID)
+
+	task, err := e.taskRepo.GetByID(ctx, taskID)
+	if err != nil {
+		e.logf("task %s: failed to load task: %v", taskID, err)
+		return
+	}
+	if task == nil {
+		e.logf("task %s: not found", taskID)
+		return
+	}
+	source, err := e.sourceRepo.GetByID(ctx, task.SourceID)
+	if err != nil {
+		e.fail(ctx, taskID, 0, 0, fmt.Sprintf("load source %d: %v", task.SourceID, err))
+		return
+	}
+	if source == nil {
+		e.fail(ctx, taskID, 0, 0, fmt.Sprintf("source %d not found", task.SourceID))
+		return
+	}
+	if !source.Enabled {
+		e.fail(ctx, taskID, 0, 0, fmt.Sprintf("source %s is disabled", source.Code))
+		return
+	}
+
+	if err := e.taskRepo.MarkRunning(ctx, taskID); err != nil {
+		e.logf("task %s: failed to set running: %v", taskID, err)
+		return
+	}
+	beatCtx, stopBeat := context.WithCancel(ctx)
+	defer stopBeat()
+	go e.heartbeat(beatCtx, taskID)
 
-		if e.logger != nil {
-			e.logger.Printf("StartFakeTask begin, task_id=%s", taskID)
+	maxPages := DefaultMaxPages
+	if task.MaxPages != nil && *task.MaxPages > 0 {
+		maxPages = *task.MaxPages
+	}
+
+	startedAt := time.Now().UTC()
+	res, err := e.crawl(ctx, task, source, maxPages)
+	if err := e.taskRepo.UpdatePosition(context.Background(), taskID, res.lastPage, res.stopReason); err != nil {
+		e.logf("task %s: failed to record position: %v", taskID, err)
+	}
+
+	if errors.Is(context.Cause(ctx), ErrEngineShutdown) {
+		// 进程退出：任务保持 running，心跳超时后从检查点被接管
+		e.logf("task %s: interrupted by shutdown after %d pages", taskID, res.pages)
+		return
+	}
+
+	status := domain.StatusCompleted
+	switch {
+	case errors.Is(context.Cause(ctx), ErrTaskStopped):
+		// 状态已经由 StopTask 写为 stopped，这里不再覆盖
+		status = domain.StatusStopped
+		e.logf("task %s: stopped after %d pages", taskID, res.pages)
+	case err != nil:
+		status = domain.StatusFailed
+		e.fail(ctx, taskID, progressOf(res.pages, 0, maxPages), res.pages, err.Error())
+	default:
+		// 部分 URL 失败时任务仍然完成，error_message 记录失败分布。
+		// 抓取结束后任务进入 awaiting_parse，等下游处理完全部 raw 消息才算 completed
+		var summary *string
+		if res.outcomes.failed > 0 {
+			msg := res.outcomes.String()
+			summary = &msg
 		}
+		if err := e.taskRepo.AwaitParse(ctx, taskID, res.pages, summary); err != nil {
+			e.logf("task %s: failed to end fetching: %v", taskID, err)
+		}
+		e.logf("task %s: fetching done, pages=%d stop_reason=%s %s", taskID, res.pages, res.stopReason, res.outcomes.String())
+		if ok, err := e.taskRepo.CompleteIfSettled(ctx, taskID); err != nil {
+			e.logf("task %s: failed to complete: %v", taskID, err)
+		} else if ok {
+			e.logf("task %s: completed", taskID)
+		}
+	}
 
-		// load task and source for potential real fetch
-		task, err := e.taskRepo.GetByID(ctx, taskID)
-		if err != nil {
-			if e.logger != nil {
-				e.logger.Printf("StartFakeTask: failed to load task %s: %v", taskID, err)
+	// 完成的任务在 CompleteIfSettled/CompleteAwaiting 里记录 last_crawl_at（抓取开始时间），下一次增量抓取以此为下限；
+	// 这里只记录停止或失败的抓取，调度器据此等一个间隔再启动
+	if status != domain.StatusCompleted {
+		if err := e.sourceRepo.UpdateLastCrawl(context.Background(), source.ID, startedAt, string(status)); err != nil {
+			e.logf("task %s: failed to update last crawl of source %d: %v", taskID, source.ID, err)
+		}
+	}
+}
+
+// heartbeat refreshes the heartbeat of a running task until ctx is done,
+// so other engines do not adopt it as orphaned. When the task is no longer active,
+// e.g. it was stopped through the API of another instance, the run is cancelled.
+func (e *Engine) heartbeat(ctx context.Context, taskID string) {
+	if e.staleAfter <= 0 {
+		return
+	}
+	t := time.NewTicker(heartbeatInterval(e.staleAfter))
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			active, err := e.taskRepo.Heartbeat(ctx, taskID)
+			if err != nil {
+				if ctx.Err() == nil {
+					e.logf("task %s: failed to record heartbeat: %v", taskID, err)
+				}
+				continue
 			}
+			if !active {
+				// 任务已在别的实例上被停止，这里也停下来
+				e.logf("task %s: no longer active, stopping", taskID)
+				e.Stop(taskID)
+				return
+			}
+		}
+	}
+}
+
+// AdoptOrphans resumes tasks left pending or running by an engine that died (their heartbeat
+// is older than CRAWLER_TASK_STALE_AFTER) from their frontier checkpoint, and completes tasks
+// awaiting the parse pipeline that are settled or timed out. It checks right away and then
+// periodically until ctx is done.
+func (e *Engine) AdoptOrphans(ctx context.Context) {
+	if e.staleAfter <= 0 {
+		return
+	}
+	t := time.NewTicker(adoptInterval(e.staleAfter))
+	defer t.Stop()
+	for {
+		ids, err := e.taskRepo.ClaimOrphaned(ctx, e.staleAfter)
+		if err != nil {
+			e.logf("adopt orphaned tasks: %v", err)
+		}
+		for _, id := range e.notRunning(ids) {
+			e.logf("task %s: adopting orphaned task", id)
+			e.StartTask(id)
+		}
+		e.completeAwaiting(ctx)
+
+		select {
+		case <-ctx.Done():
 			return
+		case <-t.C:
 		}
-		if task == nil {
-			if e.logger != nil {
-				e.logger.Printf("StartFakeTask: task %s not found", taskID)
+	}
+}
+
+// heartbeatInterval is how often a running task refreshes its heartbeat: three times per
+// staleAfter, so a live task is not taken for orphaned when a beat or two fail.
+func heartbeatInterval(staleAfter time.Duration) time.Duration {
+	if d := staleAfter / 3; d > 0 {
+		return d
+	}
+	return staleAfter
+}
+
+// adoptInterval is how often orphaned tasks are looked for: twice per staleAfter, so an
+// orphan is adopted at most 1.5 staleAfter after its last heartbeat.
+func adoptInterval(staleAfter time.Duration) time.Duration {
+	if d := staleAfter / 2; d > 0 {
+		return d
+	}
+	return staleAfter
+}
+
+// notRunning returns the ids of the claimed orphans this engine does not run itself. A task
+// of this engine can look orphaned when its heartbeat failed, e.g. while the database was down.
+func (e *Engine) notRunning(ids []string) []string {
+	var out []string
+	for _, id := range ids {
+		if !e.IsRunning(id) {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// completeAwaiting completes the tasks in the awaiting_parse stage whose raw messages have all
+// been handled downstream, or that saw no progress for CRAWLER_PARSE_TIMEOUT (zero waits forever).
+func (e *Engine) completeAwaiting(ctx context.Context) {
+	ids, err := e.taskRepo.CompleteAwaiting(ctx, e.parseTimeout)
+	if err != nil {
+		e.logf("complete awaiting tasks: %v", err)
+		return
+	}
+	for _, id := range ids {
+		e.logf("task %s: completed", id)
+	}
+}
+
+// crawlResult describes how far a crawl got and why it stopped paging.
+type crawlResult struct {
+	pages      int
+	lastPage   string
+	stopReason string
+	outcomes   outcomes
+}
+
+// cutoffOf returns the lower bound of an incremental crawl: the later of task.Since and
+// the source's last successful crawl. Full crawls walk the archive without a cutoff.
+func cutoffOf(task *domain.CrawlTask, source *domain.NewsSource) time.Time {
+	var cutoff time.Time
+	if task.Mode != domain.CrawlModeIncremental {
+		return cutoff
+	}
+	if task.Since != nil {
+		cutoff = *task.Since
+	}
+	if source.LastCrawlAt != nil && source.LastCrawlStatus != nil && *source.LastCrawlStatus == string(domain.StatusCompleted) {
+		if source.LastCrawlAt.After(cutoff) {
+			cutoff = *source.LastCrawlAt
+		}
+	}
+	return cutoff
+}
+
+// crawlRun is the state shared by the discovery walk of one task.
+type crawlRun struct {
+	task     *domain.CrawlTask
+	source   *domain.NewsSource
+	maxPages int
+	cutoff   time.Time
+	frontier *frontier
+	// listings are the pending list pages, feeds and sitemaps, in walk order.
+	listings []domain.FrontierEntry
+
+	mu  sync.Mutex // guards res.outcomes, updated by the article workers
+	res crawlResult
+}
+
+func (c *crawlRun) incremental() bool { return c.task.Mode == domain.CrawlModeIncremental }
+
+// crawl discovers article links with the source's discovery method (HTML list pages,
+// feeds or sitemaps) and fetches them. Every discovered URL is stored in the task frontier,
+// so a task adopted after a restart resumes from its checkpoint instead of starting over.
+// An error is only returned when no listing could be read at all or the task is stopped.
+func (e *Engine) crawl(ctx context.Context, task *domain.CrawlTask, source *domain.NewsSource, maxPages int) (crawlResult, error) {
+	c := &crawlRun{task: task, source: source, maxPages: maxPages, cutoff: cutoffOf(task, source), frontier: newFrontier(e.frontierRepo, task.TaskID)}
+	if c.incremental() {
+		e.logf("task %s: incremental crawl, cutoff=%s", task.TaskID, c.cutoff.Format(time.RFC3339))
+	}
+
+	plan, err := planDiscovery(source)
+	if err != nil {
+		c.res.stopReason = domain.StopReasonListPageError
+		return c.res, err
+	}
+	if err := e.restore(ctx, c, plan); err != nil {
+		c.res.stopReason = domain.StopReasonListPageError
+		if ctx.Err() != nil {
+			c.res.stopReason = domain.StopReasonStopped
+			return c.res, context.Cause(ctx)
+		}
+		return c.res, err
+	}
+	err = e.walk(ctx, c, plan)
+	return c.res, err
+}
+
+// restore loads the task frontier. A new task seeds it with the start listings of the plan;
+// a resumed task continues with its pending listings after fetching the articles that were
+// pending or in flight when it was interrupted.
+func (e *Engine) restore(ctx context.Context, c *crawlRun, plan discoveryPlan) error {
+	entries, err := c.frontier.load(ctx)
+	if err != nil {
+		return fmt.Errorf("load frontier: %w", err)
+	}
+	if len(entries) == 0 {
+		seeds := make([]domain.FrontierEntry, 0, len(plan.urls))
+		for _, u := range plan.urls {
+			seeds = append(seeds, domain.FrontierEntry{URL: u, Kind: domain.FrontierListing, State: domain.FrontierPending})
+		}
+		if err := c.frontier.add(ctx, domain.FrontierListing, 0, "", seeds); err != nil {
+			return fmt.Errorf("save frontier: %w", err)
+		}
+		c.listings = seeds
+		return nil
+	}
+
+	var articles []domain.FrontierEntry
+	for _, en := range entries {
+		pending := en.State == domain.FrontierPending || en.State == domain.FrontierFetching
+		done := en.State == domain.FrontierDone || en.State == domain.FrontierUnchanged
+		switch en.State {
+		case domain.FrontierDone:
+			c.res.outcomes.succeeded++
+		case domain.FrontierUnchanged:
+			c.res.outcomes.succeeded++
+			c.res.outcomes.unchanged++
+		case domain.FrontierFailed:
+			class := domain.FailureOther
+			if en.FailureClass != nil {
+				class = *en.FailureClass
 			}
-			return
+			c.res.outcomes.add(class)
+		}
+		switch {
+		case en.Kind == domain.FrontierListing && done:
+			c.res.pages++
+		case en.Kind == domain.FrontierListing && pending:
+			c.listings = append(c.listings, en)
+		case en.Kind == domain.FrontierArticle && pending:
+			if en.Attempts >= maxFetchAttempts {
+				// 多次中断在同一篇文章上，不再重试
+				e.recordFailure(c, en.URL, fmt.Errorf("gave up after %d interrupted attempts", en.Attempts))
+				continue
+			}
+			articles = append(articles, en)
+		}
+	}
+	if c.task.LastPageURL != nil {
+		c.res.lastPage = *c.task.LastPageURL
+	}
+	e.logf("task %s: resuming from checkpoint, %d listings done, %d pending listings, %d pending articles", c.task.TaskID, c.res.pages, len(c.listings), len(articles))
+
+	pages := c.res.pages
+	e.fetchArticles(ctx, c, articles, func(done int) {
+		e.reportProgress(ctx, c, progressOf(pages, float64(done)/float64(len(articles)), c.maxPages))
+	})
+	if ctx.Err() != nil {
+		return context.Cause(ctx)
+	}
+	return e.checkErrorRate(c)
+}
+
+// walk reads the pending listings of the frontier until none is left or max_pages is reached.
+// HTML list pages add their "next page" and sitemap indexes their child sitemaps to the frontier.
+func (e *Engine) walk(ctx context.Context, c *crawlRun, plan discoveryPlan) error {
+	for len(c.listings) > 0 {
+		if c.res.pages >= c.maxPages {
+			c.res.stopReason = domain.StopReasonMaxPages
+			return nil
+		}
+		if ctx.Err() != nil {
+			c.res.stopReason = domain.StopReasonStopped
+			return context.Cause(ctx)
+		}
+		listing := c.listings[0]
+		c.listings = c.listings[1:]
+
+		if err := e.frontierRepo.MarkFetching(ctx, c.task.TaskID, listing.URL); err != nil {
+			e.logf("task %s: failed to update frontier: %v", c.task.TaskID, err)
+		}
+		page, err := e.readListing(ctx, c, plan, listing.URL)
+		if errors.Is(err, ErrNotModified) {
+			// 列表页自上次抓取以来没有变化，不会有新文章，也不再沿它翻页
+			e.recordUnchanged(c, listing.URL)
+			c.res.pages++
+			c.res.lastPage = listing.URL
+			c.res.stopReason = domain.StopReasonNotModified
+			e.logf("task %s: listing %s not modified", c.task.TaskID, listing.URL)
+			continue
 		}
-		source, err := e.sourceRepo.GetByID(ctx, task.SourceID)
 		if err != nil {
-			if e.logger != nil {
-				e.logger.Printf("StartFakeTask: failed to load source %d: %v", task.SourceID, err)
+			if ctx.Err() != nil {
+				// 任务被停止时保留为待抓取状态
+				e.markState(c.task.TaskID, listing.URL, domain.FrontierPending, "")
+			} else {
+				e.recordFailure(c, listing.URL, err)
 			}
-		} else if source != nil && source.Enabled && source.Code == "people_military" {
-			if e.logger != nil {
-				e.logger.Printf("StartFakeTask: fetching people_military, url=%s", source.BaseURL)
+			if stop, err := e.listingFailed(ctx, c, listing.URL, err); stop {
+				return err
 			}
-			// perform a minimal real HTTP GET once for people_military
-			resp, err := http.Get(source.BaseURL)
-			if err == nil {
-				defer resp.Body.Close()
-				// read a limited snippet to avoid huge payloads
-				body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-				payload := map[string]any{
-					"task_id":      task.TaskID,
-					"source_id":    source.ID,
-					"source_code":  source.Code,
-					"url":          source.BaseURL,
-					"status_code":  resp.StatusCode,
-					"body_snippet": string(body),
-				}
-				if b, err := json.Marshal(payload); err == nil {
-					if e.logger != nil {
-						e.logger.Printf("StartFakeTask: writing to Kafka news.raw, bytes=%d", len(b))
-					}
-					if err := e.writer.WriteRaw(ctx, b); err != nil && e.logger != nil {
-						e.logger.Printf("StartFakeTask: kafka write error: %v", err)
-					}
-				}
-			} else if e.logger != nil {
-				e.logger.Printf("StartFakeTask: http get failed for %s: %v", source.BaseURL, err)
+			continue
+		}
+		// 先把文章和下一页写入抓取队列，最后才把列表页标为完成：
+		// 中途崩溃或被接管时列表页仍待抓取，重新读取它不会丢掉后面的页
+		fresh, reachedCutoff, err := e.queueLinks(ctx, c, listing, page.links)
+		if err != nil {
+			return err
+		}
+		// 列表页按时间倒序排列，大部分带日期的文章都早于下限后就不再翻页
+		if reachedCutoff && plan.method == domain.DiscoveryHTML {
+			c.res.stopReason = domain.StopReasonReachedCutoff
+		} else {
+			var nextEntries []domain.FrontierEntry
+			for _, u := range c.frontier.unseenURLs(page.next) {
+				nextEntries = append(nextEntries, domain.FrontierEntry{URL: u, Kind: domain.FrontierListing, Depth: listing.Depth + 1, State: domain.FrontierPending, ListURL: listing.URL})
+			}
+			if err := c.frontier.add(ctx, domain.FrontierListing, listing.Depth+1, listing.URL, nextEntries); err != nil {
+				return fmt.Errorf("save frontier: %w", err)
 			}
-		} else if e.logger != nil {
-			e.logger.Printf("StartFakeTask: source condition not matched, source=%+v", source)
+			c.listings = append(c.listings, nextEntries...)
+		}
+
+		failedBefore := c.failed()
+		if err := e.fetchListed(ctx, c, fresh); err != nil {
+			return err
+		}
+		e.recordSuccess(c, listing.URL)
+		c.res.lastPage = listing.URL
+		if err := e.taskRepo.UpdatePosition(ctx, c.task.TaskID, listing.URL, ""); err != nil {
+			e.logf("task %s: failed to record position: %v", c.task.TaskID, err)
 		}
+		// 只有文章全部处理成功才记住列表页的校验值，否则下次 304 会让失败的文章再也不被抓取；
+		// 异步写入时投递结果还不知道，不记
+		if c.failed() == failedBefore && !e.writer.Async() {
+			e.fetcher.SaveValidators(ctx, listing.URL, page.resp)
+		}
+		if err := e.checkErrorRate(c); err != nil {
+			return err
+		}
+	}
+	if c.res.stopReason == "" {
+		c.res.stopReason = domain.StopReasonNoNextPage
+	}
+	return nil
+}
+
+// listingPage is what readListing found on a list page, feed or sitemap.
+type listingPage struct {
+	links []articleLink
+	// next are the further listings to read: the next list page, or child sitemaps.
+	next []string
+	resp *Response
+}
 
-		// initial: set to running
-		if err := e.taskRepo.UpdateStatusAndProgress(ctx, taskID, domain.StatusRunning, 0, 0); err != nil {
-			if e.logger != nil {
-				e.logger.Printf("StartFakeTask: failed to set task %s running: %v", taskID, err)
+// readListing fetches one list page, feed or sitemap and returns the article links found on
+// it and the further listings to read. Incremental crawls send a conditional request and get
+// ErrNotModified when the listing did not change since it was last read.
+func (e *Engine) readListing(ctx context.Context, c *crawlRun, plan discoveryPlan, listURL string) (listingPage, error) {
+	switch plan.method {
+	case domain.DiscoveryFeed:
+		resp, base, err := e.fetchListing(ctx, c, listURL)
+		if err != nil {
+			return listingPage{}, err
+		}
+		links, err := parseFeed(resp.Body, base)
+		if err != nil {
+			return listingPage{}, parseFailure(err)
+		}
+		links = filterLinks(plan.patterns, links)
+		e.logf("task %s: feed %s, %d article links", c.task.TaskID, listURL, len(links))
+		return listingPage{links: links, resp: resp}, nil
+
+	case domain.DiscoverySitemap:
+		resp, base, err := e.fetchListing(ctx, c, listURL)
+		if err != nil {
+			return listingPage{}, err
+		}
+		links, children, err := parseSitemap(resp.Body, base, e.fetcher.maxBodyBytes)
+		if errors.Is(err, ErrResponseTooLarge) {
+			return listingPage{}, &FetchError{Class: domain.FailureTooLarge, Err: err}
+		}
+		if err != nil {
+			return listingPage{}, parseFailure(err)
+		}
+		var next []string
+		for _, child := range children {
+			// 增量抓取时跳过下限之前就不再更新的子 sitemap
+			if c.incremental() && !child.LastMod.IsZero() && child.LastMod.Before(c.cutoff) {
+				continue
 			}
-			return
+			next = append(next, child.URL)
+		}
+		links = filterLinks(plan.patterns, links)
+		e.logf("task %s: sitemap %s, %d article links, %d child sitemaps", c.task.TaskID, listURL, len(links), len(next))
+		return listingPage{links: links, next: next, resp: resp}, nil
+
+	default:
+		doc, resp, base, err := e.fetchDocument(ctx, c, listURL)
+		if err != nil {
+			return listingPage{}, err
+		}
+		links := extractArticleLinks(doc, base, plan.patterns)
+		e.logf("task %s: list page %d %s, %d article links", c.task.TaskID, c.res.pages+1, listURL, len(links))
+		var next []string
+		if u := findNextPage(doc, base); u != "" {
+			next = append(next, u)
+		}
+		return listingPage{links: links, next: next, resp: resp}, nil
+	}
+}
+
+// listingFailed handles a list page, feed or sitemap that could not be read. It reports
+// stop=true with the error to return when the crawl must end: the task was stopped, or not
+// a single listing has been read yet. Otherwise the failure is logged and the walk goes on.
+func (e *Engine) listingFailed(ctx context.Context, c *crawlRun, listURL string, err error) (stop bool, _ error) {
+	c.res.stopReason = domain.StopReasonListPageError
+	if ctx.Err() != nil {
+		c.res.stopReason = domain.StopReasonStopped
+		return true, context.Cause(ctx)
+	}
+	if c.res.pages == 0 {
+		return true, fmt.Errorf("fetch list page %s: %w", listURL, err)
+	}
+	e.logf("task %s: fetch list page %s failed: %v", c.task.TaskID, listURL, err)
+	return false, nil
+}
+
+// queueLinks adds the new links of one listing to the task frontier and returns the ones to
+// fetch. Links older than the cutoff of an incremental crawl, or already stored in news, are
+// recorded as skipped; reachedCutoff is set when most dated links of the listing are older than the cutoff.
+func (e *Engine) queueLinks(ctx context.Context, c *crawlRun, listing domain.FrontierEntry, links []articleLink) (fresh []domain.FrontierEntry, reachedCutoff bool, err error) {
+	reachedCutoff = c.incremental() && pastCutoff(links, c.cutoff)
+	links = c.frontier.unseen(links)
+	var stored map[string]bool
+	if c.incremental() {
+		stored = e.storedURLs(ctx, c.task.TaskID, links)
+	}
+
+	var entries []domain.FrontierEntry
+	for _, link := range links {
+		en := domain.FrontierEntry{URL: link.URL, Kind: domain.FrontierArticle, Depth: listing.Depth + 1, State: domain.FrontierPending, Anchor: link.Anchor, ListURL: listing.URL}
+		if !link.ListedAt.IsZero() {
+			listedAt := link.ListedAt
+			en.ListedAt = &listedAt
+		}
+		switch {
+		case c.incremental() && link.olderThan(c.cutoff):
+			en.State = domain.FrontierSkipped
+		case stored[link.URL]:
+			en.State = domain.FrontierSkipped
+		default:
+			fresh = append(fresh, en)
+		}
+		entries = append(entries, en)
+	}
+	if err := c.frontier.add(ctx, domain.FrontierArticle, listing.Depth+1, listing.URL, entries); err != nil {
+		return nil, reachedCutoff, fmt.Errorf("save frontier: %w", err)
+	}
+	if len(entries) > 0 {
+		if err := e.taskRepo.AddArticlesFound(ctx, c.task.TaskID, len(entries)); err != nil {
+			e.logf("task %s: failed to count found articles: %v", c.task.TaskID, err)
 		}
+	}
+	return fresh, reachedCutoff, nil
+}
+
+// fetchListed fetches the articles queued from one listing and counts the listing as a crawled page.
+func (e *Engine) fetchListed(ctx context.Context, c *crawlRun, fresh []domain.FrontierEntry) error {
+	pages := c.res.pages
+	e.fetchArticles(ctx, c, fresh, func(done int) {
+		e.reportProgress(ctx, c, progressOf(pages, float64(done)/float64(len(fresh)), c.maxPages))
+	})
+	if ctx.Err() != nil {
+		c.res.stopReason = domain.StopReasonStopped
+		return context.Cause(ctx)
+	}
 
-		progress := 0.0
-		pages := 0
+	c.res.pages++
+	e.reportProgress(ctx, c, progressOf(c.res.pages, 0, c.maxPages))
+	return nil
+}
+
+func (e *Engine) reportProgress(ctx context.Context, c *crawlRun, progress float64) {
+	if err := e.taskRepo.UpdateStatusAndProgress(ctx, c.task.TaskID, domain.StatusRunning, progress, c.res.pages); err != nil {
+		e.logf("task %s: failed to update progress: %v", c.task.TaskID, err)
+	}
+}
+
+// storedURLs returns the links already stored in news. On lookup errors nothing is reported as stored.
+func (e *Engine) storedURLs(ctx context.Context, taskID string, links []articleLink) map[string]bool {
+	if e.newsRepo == nil || len(links) == 0 {
+		return nil
+	}
+	urls := make([]string, len(links))
+	for i, l := range links {
+		urls[i] = l.URL
+	}
+	stored, err := e.newsRepo.ExistingURLs(ctx, urls)
+	if err != nil {
+		e.logf("task %s: lookup stored urls failed: %v", taskID, err)
+		return nil
+	}
+	if len(stored) > 0 {
+		e.logf("task %s: skipped %d already stored articles", taskID, len(stored))
+	}
+	return stored
+}
 
-		for i := 0; i < 5; i++ {
-			// simulate work
-			time.Sleep(1 * time.Second)
-			progress += 20
-			pages++
+// fetchArticles fetches frontier entries with up to source.MaxConcurrency workers and records
+// each outcome in the frontier; onDone is called (serially) with the number of finished entries.
+func (e *Engine) fetchArticles(ctx context.Context, c *crawlRun, entries []domain.FrontierEntry, onDone func(done int)) {
+	workers := c.source.MaxConcurrency
+	if workers < 1 {
+		workers = 1
+	}
+	if workers > len(entries) {
+		workers = len(entries)
+	}
 
-			if err := e.taskRepo.UpdateStatusAndProgress(ctx, taskID, domain.StatusRunning, progress, pages); err != nil {
-				if e.logger != nil {
-					e.logger.Printf("failed to update task %s progress: %v", taskID, err)
+	jobs := make(chan domain.FrontierEntry)
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		done int
+	)
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for en := range jobs {
+				if err := e.frontierRepo.MarkFetching(ctx, c.task.TaskID, en.URL); err != nil {
+					e.logf("task %s: failed to update frontier: %v", c.task.TaskID, err)
 				}
-				return
+				err := e.fetchArticle(ctx, c, en.ListURL, en.URL)
+				switch {
+				case err == nil && e.writer.Async():
+					// 异步写入时由投递回调记录结果，这里只计数
+					c.mu.Lock()
+					c.res.outcomes.succeeded++
+					c.mu.Unlock()
+				case err == nil:
+					e.recordSuccess(c, en.URL)
+				case errors.Is(err, ErrNotModified):
+					e.recordUnchanged(c, en.URL)
+				case ctx.Err() != nil:
+					e.markState(c.task.TaskID, en.URL, domain.FrontierPending, "")
+				default:
+					e.logf("task %s: article %s: %v", c.task.TaskID, en.URL, err)
+					e.recordFailure(c, en.URL, err)
+				}
+				mu.Lock()
+				done++
+				onDone(done)
+				mu.Unlock()
 			}
+		}()
+	}
+
+	for _, en := range entries {
+		if ctx.Err() != nil {
+			break
 		}
+		jobs <- en
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// recordSuccess marks a fetched frontier entry as done and counts it.
+func (e *Engine) recordSuccess(c *crawlRun, url string) {
+	e.markState(c.task.TaskID, url, domain.FrontierDone, "")
+	c.mu.Lock()
+	c.res.outcomes.succeeded++
+	c.mu.Unlock()
+}
 
-		// final: completed
-		if err := e.taskRepo.UpdateStatusAndProgress(ctx, taskID, domain.StatusCompleted, 100, pages); err != nil {
-			if e.logger != nil {
-				e.logger.Printf("failed to complete task %s: %v", taskID, err)
+// recordUnchanged marks a frontier entry answered with 304 Not Modified and counts it
+// as succeeded and in the not_modified counter of the task.
+func (e *Engine) recordUnchanged(c *crawlRun, url string) {
+	e.markState(c.task.TaskID, url, domain.FrontierUnchanged, "")
+	if err := e.taskRepo.AddFetchStats(context.Background(), c.task.TaskID, 1, 0); err != nil {
+		e.logf("task %s: failed to count not modified: %v", c.task.TaskID, err)
+	}
+	c.mu.Lock()
+	c.res.outcomes.succeeded++
+	c.res.outcomes.unchanged++
+	c.mu.Unlock()
+}
+
+// recordFailure marks a frontier entry as failed with the class of err, and counts it
+// in the outcomes and the errors counter of the task.
+func (e *Engine) recordFailure(c *crawlRun, url string, err error) {
+	class := failureClass(err)
+	if err := e.frontierRepo.MarkFailed(context.Background(), c.task.TaskID, url, class, err.Error()); err != nil {
+		e.logf("task %s: failed to update frontier: %v", c.task.TaskID, err)
+	}
+	if err := e.taskRepo.AddErrors(context.Background(), c.task.TaskID, 1); err != nil {
+		e.logf("task %s: failed to count error: %v", c.task.TaskID, err)
+	}
+	c.mu.Lock()
+	c.res.outcomes.add(class)
+	c.mu.Unlock()
+}
+
+// failed returns the number of URLs of the task that failed so far.
+func (c *crawlRun) failed() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.res.outcomes.failed
+}
+
+// checkErrorRate fails the crawl once the share of failed URLs passes CRAWLER_MAX_ERROR_RATE.
+func (e *Engine) checkErrorRate(c *crawlRun) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	o := c.res.outcomes
+	total := o.succeeded + o.failed
+	if e.maxErrorRate <= 0 || total == 0 || total < e.minErrorSample {
+		return nil
+	}
+	if rate := float64(o.failed) / float64(total); rate > e.maxErrorRate {
+		return fmt.Errorf("error rate %.0f%% exceeds %.0f%%: %s", rate*100, e.maxErrorRate*100, o.String())
+	}
+	return nil
+}
+
+// markState records the state of a frontier entry. It uses a background context so the
+// outcome is kept even when the task has just been stopped.
+func (e *Engine) markState(taskID, url, state, errMsg string) {
+	var msg *string
+	if errMsg != "" {
+		msg = &errMsg
+	}
+	if err := e.frontierRepo.MarkState(context.Background(), taskID, url, state, msg); err != nil {
+		e.logf("task %s: failed to update frontier: %v", taskID, err)
+	}
+}
+
+// fetchArticle downloads one article page and writes it into news.raw. An unchanged page
+// of an incremental crawl returns ErrNotModified and is not written again.
+func (e *Engine) fetchArticle(ctx context.Context, c *crawlRun, listURL, articleURL string) error {
+	task, source := c.task, c.source
+	resp, err := e.get(ctx, c, articleURL)
+	if err != nil {
+		return err
+	}
+
+	body, cs, err := toUTF8(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return parseFailure(fmt.Errorf("decode %s body: %w", cs, err))
+	}
+	packed, err := blob.Pack(ctx, body, e.packOpts, e.store)
+	if err != nil {
+		return err
+	}
+	payload := pipeline.RawMessage{
+		Envelope:     pipeline.NewEnvelope(pipeline.RawVersion, ProducerName, ""),
+		TaskID:       task.TaskID,
+		SourceID:     source.ID,
+		SourceCode:   source.Code,
+		URL:          articleURL,
+		ListURL:      listURL,
+		StatusCode:   resp.StatusCode,
+		Charset:      cs,
+		Body:         packed.Body,
+		BodyEncoding: packed.Encoding,
+		BodyRef:      packed.Ref,
+		BodySize:     packed.Size,
+	}
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	if err := e.writer.WriteRaw(ctx, kafka.Key(articleURL), b); err != nil {
+		return fmt.Errorf("kafka write: %w", err)
+	}
+	if e.writer.Async() {
+		// 投递成功后由 RawDelivered 计数；投递结果未知，不记校验值
+		return nil
+	}
+	if err := e.taskRepo.AddRawMessages(context.Background(), task.TaskID, 1); err != nil {
+		e.logf("task %s: failed to count raw message: %v", task.TaskID, err)
+	}
+	e.fetcher.SaveValidators(ctx, articleURL, resp)
+	return nil
+}
+
+// RawDelivered returns the delivery callback of an async news.raw writer. Articles written
+// asynchronously stay in the fetching state until their message is delivered: delivered ones
+// are then marked done and counted in raw_messages, lost ones are marked failed and counted
+// in errors, so the task does not wait for them in awaiting_parse.
+func RawDelivered(frontierRepo *repository.FrontierRepo, taskRepo *repository.TaskRepo, logger *log.Logger) kafka.DeliveryFunc {
+	return func(topic string, msgs []kafkago.Message, err error) {
+		ctx := context.Background()
+		delivered := make(map[string]int)
+		for _, m := range msgs {
+			raw, derr := pipeline.DecodeRaw(m.Value)
+			if derr != nil || raw.TaskID == "" {
+				continue
+			}
+			if err == nil {
+				if ferr := frontierRepo.MarkState(ctx, raw.TaskID, raw.URL, domain.FrontierDone, nil); ferr != nil && logger != nil {
+					logger.Printf("task %s: failed to update frontier: %v", raw.TaskID, ferr)
+				}
+				delivered[raw.TaskID]++
+				continue
+			}
+			if logger != nil {
+				logger.Printf("task %s: delivery of %s to %s failed: %v", raw.TaskID, raw.URL, topic, err)
+			}
+			if ferr := frontierRepo.MarkFailed(ctx, raw.TaskID, raw.URL, domain.FailureOther, "kafka delivery: "+err.Error()); ferr != nil && logger != nil {
+				logger.Printf("task %s: failed to update frontier: %v", raw.TaskID, ferr)
+			}
+			if terr := taskRepo.AddErrors(ctx, raw.TaskID, 1); terr != nil && logger != nil {
+				logger.Printf("task %s: failed to count error: %v", raw.TaskID, terr)
 			}
 		}
-	}()
+		for taskID, n := range delivered {
+			if terr := taskRepo.AddRawMessages(ctx, taskID, n); terr != nil && logger != nil {
+				logger.Printf("task %s: failed to count raw messages: %v", taskID, terr)
+			}
+		}
+	}
+}
+
+// get fetches a page for the task, as a conditional request in incremental crawls,
+// and counts the downloaded bytes.
+func (e *Engine) get(ctx context.Context, c *crawlRun, pageURL string) (*Response, error) {
+	var (
+		resp *Response
+		err  error
+	)
+	if c.incremental() {
+		resp, err = e.fetcher.GetIfChanged(ctx, pageURL, c.source.MaxConcurrency)
+	} else {
+		resp, err = e.fetcher.Get(ctx, pageURL, c.source.MaxConcurrency)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := e.taskRepo.AddFetchStats(context.Background(), c.task.TaskID, 0, int64(len(resp.Body))); err != nil {
+		e.logf("task %s: failed to count fetched bytes: %v", c.task.TaskID, err)
+	}
+	return resp, nil
+}
+
+// fetchListing fetches a listing and returns the response and its final URL (after redirects),
+// which is the base for resolving relative links.
+func (e *Engine) fetchListing(ctx context.Context, c *crawlRun, pageURL string) (*Response, *url.URL, error) {
+	resp, err := e.get(ctx, c, pageURL)
+	if err != nil {
+		return nil, nil, err
+	}
+	base, err := url.Parse(resp.URL)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, base, nil
+}
+
+func (e *Engine) fetchDocument(ctx context.Context, c *crawlRun, pageURL string) (*goquery.Document, *Response, *url.URL, error) {
+	resp, base, err := e.fetchListing(ctx, c, pageURL)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	body, cs, err := toUTF8(resp.Body, resp.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, nil, nil, parseFailure(fmt.Errorf("decode %s body: %w", cs, err))
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, nil, nil, parseFailure(err)
+	}
+	return doc, resp, base, nil
+}
+
+func (e *Engine) fail(ctx context.Context, taskID string, progress float64, pages int, msg string) {
+	e.logf("task %s: failed: %s", taskID, msg)
+	if err := e.taskRepo.Finish(ctx, taskID, domain.StatusFailed, progress, pages, &msg); err != nil {
+		e.logf("task %s: failed to mark failed: %v", taskID, err)
+	}
+}
+
+func (e *Engine) logf(format string, args ...any) {
+	if e.logger != nil {
+		e.logger.Printf(format, args...)
+	}
+}
+
+// progressOf returns the task progress in percent given finished list pages and
+// the fraction of the current page already done.
+func progressOf(pages int, current float64, maxPages int) float64 {
+	if maxPages <= 0 {
+		return 0
+	}
+	p := (float64(pages) + current) / float64(maxPages) * 100
+	if p > 100 {
+		p = 100
+	}
+	return p
 }
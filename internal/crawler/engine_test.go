@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	"recommand/internal/domain"
+)
+
+func TestHeartbeatInterval(t *testing.T) {
+	tests := []struct {
+		staleAfter time.Duration
+		heartbeat  time.Duration
+		adopt      time.Duration
+	}{
+		{5 * time.Minute, 100 * time.Second, 150 * time.Second},
+		{90 * time.Second, 30 * time.Second, 45 * time.Second},
+		// 过小的 staleAfter 不能让 NewTicker 因间隔为 0 而 panic
+		{2 * time.Nanosecond, 2 * time.Nanosecond, time.Nanosecond},
+		{time.Nanosecond, time.Nanosecond, time.Nanosecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.staleAfter.String(), func(t *testing.T) {
+			if got := heartbeatInterval(tt.staleAfter); got != tt.heartbeat {
+				t.Errorf("heartbeatInterval(%s) = %s, want %s", tt.staleAfter, got, tt.heartbeat)
+			}
+			if got := adoptInterval(tt.staleAfter); got != tt.adopt {
+				t.Errorf("adoptInterval(%s) = %s, want %s", tt.staleAfter, got, tt.adopt)
+			}
+		})
+	}
+}
+
+// A live task must beat several times within staleAfter, or an engine checking for orphans
+// between two beats would adopt it while it still runs.
+func TestHeartbeatKeepsTaskFresh(t *testing.T) {
+	for _, staleAfter := range []time.Duration{30 * time.Second, time.Minute, 5 * time.Minute, time.Hour} {
+		if beats := staleAfter / heartbeatInterval(staleAfter); beats < 3 {
+			t.Errorf("staleAfter %s: %d heartbeats per staleAfter, want at least 3", staleAfter, beats)
+		}
+		// 孤儿最迟在最后一次心跳后 staleAfter + 一个检查间隔被接管
+		if adopt := adoptInterval(staleAfter); adopt > staleAfter {
+			t.Errorf("staleAfter %s: adoptInterval %s exceeds it", staleAfter, adopt)
+		}
+	}
+}
+
+func TestNotRunning(t *testing.T) {
+	e := &Engine{running: map[string]context.CancelCauseFunc{"b": nil}}
+	tests := []struct {
+		name string
+		ids  []string
+		want []string
+	}{
+		{"none claimed", nil, nil},
+		{"all orphaned", []string{"a", "c"}, []string{"a", "c"}},
+		{"skips tasks running here", []string{"a", "b", "c"}, []string{"a", "c"}},
+		{"only tasks running here", []string{"b"}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := e.notRunning(tt.ids); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("notRunning(%v) = %v, want %v", tt.ids, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCutoffOf(t *testing.T) {
+	since := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	before := since.Add(-24 * time.Hour)
+	after := since.Add(24 * time.Hour)
+	completed := string(domain.StatusCompleted)
+	failed := string(domain.StatusFailed)
+
+	tests := []struct {
+		name   string
+		mode   domain.CrawlMode
+		since  *time.Time
+		last   *time.Time
+		status *string
+		want   time.Time
+	}{
+		{"full crawl has no cutoff", domain.CrawlModeFull, &since, &after, &completed, time.Time{}},
+		{"never crawled", domain.CrawlModeIncremental, nil, nil, nil, time.Time{}},
+		{"since only", domain.CrawlModeIncremental, &since, nil, nil, since},
+		{"last completed crawl", domain.CrawlModeIncremental, nil, &after, &completed, after},
+		{"later last crawl wins", domain.CrawlModeIncremental, &since, &after, &completed, after},
+		{"later since wins", domain.CrawlModeIncremental, &since, &before, &completed, since},
+		{"failed crawl ignored", domain.CrawlModeIncremental, &since, &after, &failed, since},
+		{"crawl without status ignored", domain.CrawlModeIncremental, nil, &after, nil, time.Time{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			task := &domain.CrawlTask{Mode: tt.mode, Since: tt.since}
+			source := &domain.NewsSource{LastCrawlAt: tt.last, LastCrawlStatus: tt.status}
+			if got := cutoffOf(task, source); !got.Equal(tt.want) {
+				t.Errorf("cutoffOf = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,198 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"recommand/internal/domain"
+)
+
+// FetchError is a classified fetch failure. Non-2xx responses are failures too.
+type FetchError struct {
+	Class      string
+	StatusCode int
+	// RetryAfter is the delay requested by a 429/503 response, zero if none.
+	RetryAfter time.Duration
+	// Attempts is the number of requests made before giving up.
+	Attempts int
+	Err      error
+}
+
+func (e *FetchError) Error() string {
+	msg := e.Class
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	if e.Attempts > 1 {
+		msg += fmt.Sprintf(" (after %d attempts)", e.Attempts)
+	}
+	return msg
+}
+
+func (e *FetchError) Unwrap() error { return e.Err }
+
+// Transient reports whether the failure may go away on retry.
+func (e *FetchError) Transient() bool {
+	switch e.Class {
+	case domain.FailureTimeout, domain.FailureNetwork, domain.FailureHTTP5xx, domain.FailureRateLimited:
+		return true
+	case domain.FailureDNS:
+		// 只有 "no such host" 是确定的失败，其他 DNS 错误通常是暂时的
+		var dnsErr *net.DNSError
+		return errors.As(e.Err, &dnsErr) && !dnsErr.IsNotFound
+	}
+	return false
+}
+
+// classify turns the result of Fetcher.Fetch into a *FetchError, or nil on success (2xx).
+func classify(resp *Response, err error) *FetchError {
+	if err != nil {
+		var (
+			dnsErr *net.DNSError
+			netErr net.Error
+		)
+		switch {
+		case errors.Is(err, ErrDisallowedByRobots):
+			return &FetchError{Class: domain.FailureRobots, Err: err}
+		case errors.Is(err, ErrRobotsUnavailable):
+			// robots.txt 暂时取不到，和 5xx 一样稍后重试
+			return &FetchError{Class: domain.FailureHTTP5xx, Err: err}
+		case errors.Is(err, ErrResponseTooLarge):
+			return &FetchError{Class: domain.FailureTooLarge, Err: err}
+		case errors.As(err, &dnsErr):
+			return &FetchError{Class: domain.FailureDNS, Err: err}
+		case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+			return &FetchError{Class: domain.FailureTimeout, Err: err}
+		case errors.As(err, &netErr):
+			return &FetchError{Class: domain.FailureNetwork, Err: err}
+		}
+		return &FetchError{Class: domain.FailureOther, Err: err}
+	}
+
+	code := resp.StatusCode
+	if code >= 200 && code < 300 {
+		return nil
+	}
+	fe := &FetchError{StatusCode: code, Err: fmt.Errorf("unexpected status %d", code)}
+	switch {
+	case code == http.StatusTooManyRequests:
+		fe.Class = domain.FailureRateLimited
+	case code >= 500:
+		fe.Class = domain.FailureHTTP5xx
+	case code >= 400:
+		fe.Class = domain.FailureHTTP4xx
+	default:
+		fe.Class = domain.FailureOther
+	}
+	if code == http.StatusTooManyRequests || code == http.StatusServiceUnavailable {
+		fe.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	}
+	return fe
+}
+
+// parseFailure marks err as a failure to decode or parse a fetched page.
+func parseFailure(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &FetchError{Class: domain.FailureParse, Err: err}
+}
+
+// failureClass returns the class of a failure; errors that are not fetch errors
+// (e.g. Kafka writes) are "other".
+func failureClass(err error) string {
+	var fe *FetchError
+	if errors.As(err, &fe) {
+		return fe.Class
+	}
+	return domain.FailureOther
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// backoff returns the delay before retry number attempt+1: the exponential backoff with
+// jitter, capped at maxDelay, or the server's Retry-After when it is longer. ok is false
+// when the server asks to wait longer than maxDelay.
+func backoff(attempt int, base, maxDelay, retryAfter time.Duration) (d time.Duration, ok bool) {
+	if retryAfter > maxDelay {
+		return 0, false
+	}
+	d = base << uint(attempt)
+	if d <= 0 || d > maxDelay {
+		// 移位溢出或已超过上限，先截断以免加抖动时再溢出
+		d = maxDelay
+	}
+	// 加入最多 20% 的随机抖动，避免多个任务同时重试；抖动之后再按上限截断
+	if d > 0 {
+		d += time.Duration(rand.Int63n(int64(d)/5 + 1))
+	}
+	if d > maxDelay {
+		d = maxDelay
+	}
+	if retryAfter > d {
+		d = retryAfter
+	}
+	return d, true
+}
+
+// outcomes counts the fetch results of a task by failure class.
+type outcomes struct {
+	succeeded int
+	failed    int
+	// unchanged counts the succeeded URLs that were answered with 304 Not Modified.
+	unchanged int
+	byClass   map[string]int
+}
+
+func (o *outcomes) add(class string) {
+	if o.byClass == nil {
+		o.byClass = make(map[string]int)
+	}
+	o.failed++
+	o.byClass[class]++
+}
+
+// String summarizes the outcomes, e.g. "3 of 40 urls failed (http_4xx=2, timeout=1)".
+func (o outcomes) String() string {
+	total := o.succeeded + o.failed
+	if o.failed == 0 {
+		if o.unchanged > 0 {
+			return fmt.Sprintf("%d urls fetched, %d unchanged", total, o.unchanged)
+		}
+		return fmt.Sprintf("%d urls fetched", total)
+	}
+	classes := make([]string, 0, len(o.byClass))
+	for class := range o.byClass {
+		classes = append(classes, class)
+	}
+	sort.Strings(classes)
+	parts := make([]string, len(classes))
+	for i, class := range classes {
+		parts[i] = fmt.Sprintf("%s=%d", class, o.byClass[class])
+	}
+	return fmt.Sprintf("%d of %d urls failed (%s)", o.failed, total, strings.Join(parts, ", "))
+}
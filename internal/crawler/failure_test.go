@@ -0,0 +1,150 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"recommand/internal/domain"
+)
+
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
+
+func TestClassify(t *testing.T) {
+	status := func(code int, header ...string) *Response {
+		h := http.Header{}
+		for i := 0; i+1 < len(header); i += 2 {
+			h.Set(header[i], header[i+1])
+		}
+		return &Response{StatusCode: code, Header: h}
+	}
+	tests := []struct {
+		name           string
+		resp           *Response
+		err            error
+		wantClass      string
+		wantTransient  bool
+		wantRetryAfter time.Duration
+	}{
+		{"robots", nil, fmt.Errorf("fetch: %w", ErrDisallowedByRobots), domain.FailureRobots, false, 0},
+		{"robots unavailable", nil, fmt.Errorf("robots: %w", ErrRobotsUnavailable), domain.FailureHTTP5xx, true, 0},
+		{"too large", nil, fmt.Errorf("read body: %w", ErrResponseTooLarge), domain.FailureTooLarge, false, 0},
+		{"dns not found", nil, &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}, domain.FailureDNS, false, 0},
+		{"dns temporary", nil, &net.DNSError{Err: "server misbehaving", Name: "example.com", IsTemporary: true}, domain.FailureDNS, true, 0},
+		{"deadline", nil, fmt.Errorf("get: %w", context.DeadlineExceeded), domain.FailureTimeout, true, 0},
+		{"net timeout", nil, &net.OpError{Op: "read", Err: timeoutError{}}, domain.FailureTimeout, true, 0},
+		{"connection refused", nil, &net.OpError{Op: "dial", Err: errors.New("connection refused")}, domain.FailureNetwork, true, 0},
+		{"other error", nil, errors.New("boom"), domain.FailureOther, false, 0},
+		{"404", status(404), nil, domain.FailureHTTP4xx, false, 0},
+		{"429 with retry-after", status(429, "Retry-After", "30"), nil, domain.FailureRateLimited, true, 30 * time.Second},
+		{"500", status(500, "Retry-After", "30"), nil, domain.FailureHTTP5xx, true, 0},
+		{"503 with retry-after", status(503, "Retry-After", "5"), nil, domain.FailureHTTP5xx, true, 5 * time.Second},
+		{"3xx", status(304), nil, domain.FailureOther, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fe := classify(tt.resp, tt.err)
+			if fe == nil {
+				t.Fatal("classify = nil, want a failure")
+			}
+			if fe.Class != tt.wantClass {
+				t.Errorf("Class = %s, want %s", fe.Class, tt.wantClass)
+			}
+			if fe.Transient() != tt.wantTransient {
+				t.Errorf("Transient() = %v, want %v", fe.Transient(), tt.wantTransient)
+			}
+			if fe.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("RetryAfter = %s, want %s", fe.RetryAfter, tt.wantRetryAfter)
+			}
+			if tt.err != nil && !errors.Is(fe, tt.err) {
+				t.Errorf("classified error does not wrap %v", tt.err)
+			}
+		})
+	}
+
+	for _, code := range []int{200, 204} {
+		if fe := classify(status(code), nil); fe != nil {
+			t.Errorf("classify(%d) = %v, want nil", code, fe)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 3, 5, 8, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Duration
+	}{
+		{"", 0},
+		{"120", 2 * time.Minute},
+		{" 0 ", 0},
+		{"-5", 0},
+		{"Tue, 05 Mar 2024 08:01:30 GMT", 90 * time.Second},
+		{"Tue, 05 Mar 2024 07:59:00 GMT", 0},
+		{"soon", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.in, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %s, want %s", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name       string
+		attempt    int
+		base       time.Duration
+		maxDelay   time.Duration
+		retryAfter time.Duration
+		min, max   time.Duration
+		wantOK     bool
+	}{
+		{"first retry", 0, time.Second, time.Minute, 0, time.Second, 1200 * time.Millisecond, true},
+		{"doubles per attempt", 3, time.Second, time.Minute, 0, 8 * time.Second, 9600 * time.Millisecond, true},
+		{"capped at max", 10, time.Second, 5 * time.Second, 0, 5 * time.Second, 5 * time.Second, true},
+		{"jitter capped at max", 2, time.Second, 4500 * time.Millisecond, 0, 4 * time.Second, 4500 * time.Millisecond, true},
+		{"shift overflow", 80, time.Second, time.Minute, 0, time.Minute, time.Minute, true},
+		{"retry-after longer than backoff", 0, time.Second, time.Minute, 20 * time.Second, 20 * time.Second, 20 * time.Second, true},
+		{"retry-after beyond max", 0, time.Second, time.Minute, 2 * time.Minute, 0, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for i := 0; i < 50; i++ {
+				d, ok := backoff(tt.attempt, tt.base, tt.maxDelay, tt.retryAfter)
+				if ok != tt.wantOK {
+					t.Fatalf("backoff ok = %v, want %v", ok, tt.wantOK)
+				}
+				if d < tt.min || d > tt.max {
+					t.Fatalf("backoff = %s, want between %s and %s", d, tt.min, tt.max)
+				}
+			}
+		})
+	}
+}
+
+func TestOutcomesString(t *testing.T) {
+	var o outcomes
+	o.succeeded = 37
+	if got, want := o.String(), "37 urls fetched"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	o.unchanged = 12
+	if got, want := o.String(), "37 urls fetched, 12 unchanged"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	o.add(domain.FailureTimeout)
+	o.add(domain.FailureHTTP4xx)
+	o.add(domain.FailureHTTP4xx)
+	if got, want := o.String(), "3 of 40 urls failed (http_4xx=2, timeout=1)"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+}
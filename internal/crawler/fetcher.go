@@ -0,0 +1,427 @@
+package crawler
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"recommand/internal/config"
+	"recommand/internal/repository"
+)
+
+var (
+	// ErrDisallowedByRobots is returned when robots.txt forbids fetching a URL.
+	ErrDisallowedByRobots = errors.New("disallowed by robots.txt")
+	// ErrResponseTooLarge is returned when a body exceeds CRAWLER_MAX_BODY_BYTES.
+	ErrResponseTooLarge = errors.New("response body too large")
+	// ErrNotModified is returned by GetIfChanged when the server answered 304 Not Modified.
+	ErrNotModified = errors.New("not modified")
+	// ErrRobotsUnavailable is returned while a host answers its robots.txt with a 5xx error.
+	ErrRobotsUnavailable = errors.New("robots.txt unavailable")
+)
+
+// robotsRetryAfter is how long a robots.txt answered with 5xx counts as disallowing everything
+// before it is fetched again.
+const robotsRetryAfter = time.Minute
+
+// Response is a fully read HTTP response.
+type Response struct {
+	URL        string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+// Fetcher is a polite HTTP client: it limits concurrency and request rate per host,
+// honors robots.txt (including Crawl-delay) and sends a configurable User-Agent.
+type Fetcher struct {
+	client        *http.Client
+	userAgent     string
+	rps           float64
+	respectRobots bool
+	robotsTTL     time.Duration
+	maxBodyBytes  int64
+	maxRetries    int
+	retryBase     time.Duration
+	retryMax      time.Duration
+	// cache stores ETag/Last-Modified validators for conditional GETs; nil disables them.
+	cache  *repository.HTTPCacheRepo
+	logger *log.Logger
+
+	mu     sync.Mutex
+	hosts  map[string]*hostLimiter
+	robots map[string]*robotsEntry
+	// robotsLoading holds a channel per robots.txt being fetched, closed when the fetch is done,
+	// so concurrent workers wait for one request instead of all fetching it.
+	robotsLoading map[string]chan struct{}
+}
+
+type robotsEntry struct {
+	rules     *robotsRules
+	err       error
+	fetchedAt time.Time
+	ttl       time.Duration
+}
+
+// hostLimiter bounds in-flight requests and spaces request starts for one host.
+// It is created once per host and never replaced, so every request releases the slot it took.
+type hostLimiter struct {
+	mu       sync.Mutex
+	inFlight int
+	// released is closed and replaced whenever a request finishes, waking up waiting requests.
+	released chan struct{}
+	next     time.Time
+	interval time.Duration
+}
+
+func NewFetcher(cfg config.CrawlerConfig, cache *repository.HTTPCacheRepo, logger *log.Logger) *Fetcher {
+	if !cfg.ConditionalGet {
+		cache = nil
+	}
+	return &Fetcher{
+		client:        &http.Client{Timeout: cfg.RequestTimeout},
+		userAgent:     cfg.UserAgent,
+		rps:           cfg.RequestsPerSecond,
+		respectRobots: cfg.RespectRobots,
+		robotsTTL:     cfg.RobotsCacheTTL,
+		maxBodyBytes:  cfg.MaxBodyBytes,
+		maxRetries:    cfg.MaxRetries,
+		retryBase:     cfg.RetryBaseDelay,
+		retryMax:      cfg.RetryMaxDelay,
+		cache:         cache,
+		logger:        logger,
+		hosts:         make(map[string]*hostLimiter),
+		robots:        make(map[string]*robotsEntry),
+		robotsLoading: make(map[string]chan struct{}),
+	}
+}
+
+// Fetch GETs rawURL once the host's politeness budget allows it.
+// maxConcurrency is the source's MaxConcurrency and bounds in-flight requests to the host.
+func (f *Fetcher) Fetch(ctx context.Context, rawURL string, maxConcurrency int) (*Response, error) {
+	return f.fetch(ctx, rawURL, maxConcurrency, nil)
+}
+
+func (f *Fetcher) fetch(ctx context.Context, rawURL string, maxConcurrency int, header http.Header) (*Response, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	lim := f.limiter(u.Host)
+	interval := f.minInterval()
+	if f.respectRobots {
+		rules, err := f.robotsFor(ctx, u, lim, maxConcurrency)
+		if err != nil {
+			return nil, err
+		}
+		if !rules.allowed(u.RequestURI()) {
+			return nil, ErrDisallowedByRobots
+		}
+		if rules.crawlDelay > interval {
+			interval = rules.crawlDelay
+		}
+	}
+	lim.setInterval(interval)
+	return f.limited(ctx, lim, maxConcurrency, rawURL, header)
+}
+
+// limited performs one request within the politeness budget of the host.
+func (f *Fetcher) limited(ctx context.Context, lim *hostLimiter, maxConcurrency int, rawURL string, header http.Header) (*Response, error) {
+	if err := lim.acquire(ctx, maxConcurrency); err != nil {
+		return nil, err
+	}
+	defer lim.release()
+	if err := lim.wait(ctx); err != nil {
+		return nil, err
+	}
+	return f.do(ctx, rawURL, header)
+}
+
+// Get fetches rawURL like Fetch and retries transient failures (timeouts, network errors,
+// 5xx and 429) with exponential backoff, honoring Retry-After. Every failure, including a
+// non-2xx response, is returned as a *FetchError; a cancelled ctx returns its error.
+func (f *Fetcher) Get(ctx context.Context, rawURL string, maxConcurrency int) (*Response, error) {
+	return f.get(ctx, rawURL, maxConcurrency, nil)
+}
+
+// GetIfChanged is Get as a conditional request: it sends the ETag/Last-Modified validators
+// remembered by SaveValidators and returns ErrNotModified when the page did not change.
+func (f *Fetcher) GetIfChanged(ctx context.Context, rawURL string, maxConcurrency int) (*Response, error) {
+	if f.cache == nil {
+		return f.get(ctx, rawURL, maxConcurrency, nil)
+	}
+	header := http.Header{}
+	etag, lastModified, err := f.cache.Get(ctx, rawURL)
+	if err != nil {
+		f.logf("load validators of %s: %v", rawURL, err)
+	}
+	if etag != "" {
+		header.Set("If-None-Match", etag)
+	}
+	if lastModified != "" {
+		header.Set("If-Modified-Since", lastModified)
+	}
+	return f.get(ctx, rawURL, maxConcurrency, header)
+}
+
+// SaveValidators remembers the ETag/Last-Modified of a processed response for later
+// conditional requests. Call it only once the page has been handled completely, so a
+// page that failed downstream is fetched again next time.
+func (f *Fetcher) SaveValidators(ctx context.Context, rawURL string, resp *Response) {
+	if f.cache == nil || resp == nil {
+		return
+	}
+	etag, lastModified := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	if etag == "" && lastModified == "" {
+		return
+	}
+	if err := f.cache.Put(ctx, rawURL, etag, lastModified); err != nil {
+		f.logf("save validators of %s: %v", rawURL, err)
+	}
+}
+
+func (f *Fetcher) get(ctx context.Context, rawURL string, maxConcurrency int, header http.Header) (*Response, error) {
+	for attempt := 0; ; attempt++ {
+		resp, err := f.fetch(ctx, rawURL, maxConcurrency, header)
+		if ctx.Err() != nil {
+			return nil, context.Cause(ctx)
+		}
+		if err == nil && resp.StatusCode == http.StatusNotModified {
+			return nil, ErrNotModified
+		}
+		fe := classify(resp, err)
+		if fe == nil {
+			return resp, nil
+		}
+		fe.Attempts = attempt + 1
+		if !fe.Transient() || attempt >= f.maxRetries {
+			return nil, fe
+		}
+		d, ok := backoff(attempt, f.retryBase, f.retryMax, fe.RetryAfter)
+		if !ok {
+			return nil, fe
+		}
+		if fe.RetryAfter > 0 {
+			// Retry-After 对整个站点生效，其他请求也一起等待
+			if u, err := url.Parse(rawURL); err == nil {
+				f.pauseHost(u.Host, fe.RetryAfter)
+			}
+		}
+		f.logf("fetch %s failed (%v), retry %d/%d in %s", rawURL, fe, attempt+1, f.maxRetries, d.Round(time.Millisecond))
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return nil, context.Cause(ctx)
+		}
+	}
+}
+
+// pauseHost delays the next request slot of host by at least d.
+func (f *Fetcher) pauseHost(host string, d time.Duration) {
+	f.mu.Lock()
+	lim, ok := f.hosts[host]
+	f.mu.Unlock()
+	if !ok {
+		return
+	}
+	lim.mu.Lock()
+	if until := time.Now().Add(d); lim.next.Before(until) {
+		lim.next = until
+	}
+	lim.mu.Unlock()
+}
+
+func (f *Fetcher) do(ctx context.Context, rawURL string, header http.Header) (*Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var r io.Reader = resp.Body
+	if f.maxBodyBytes > 0 {
+		r = io.LimitReader(resp.Body, f.maxBodyBytes+1)
+	}
+	body, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("read body: %w", err)
+	}
+	if f.maxBodyBytes > 0 && int64(len(body)) > f.maxBodyBytes {
+		return nil, fmt.Errorf("%w: more than %d bytes", ErrResponseTooLarge, f.maxBodyBytes)
+	}
+	return &Response{URL: resp.Request.URL.String(), StatusCode: resp.StatusCode, Header: resp.Header, Body: body}, nil
+}
+
+// limiter returns the limiter of host, creating it on first use.
+func (f *Fetcher) limiter(host string) *hostLimiter {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	lim, ok := f.hosts[host]
+	if !ok {
+		lim = &hostLimiter{released: make(chan struct{}), interval: f.minInterval()}
+		f.hosts[host] = lim
+	}
+	return lim
+}
+
+// minInterval is the spacing of request starts per host given by CRAWLER_REQUESTS_PER_SECOND.
+func (f *Fetcher) minInterval() time.Duration {
+	if f.rps <= 0 {
+		return 0
+	}
+	return time.Duration(float64(time.Second) / f.rps)
+}
+
+// acquire takes an in-flight slot of the host. limit is the concurrency of the calling source:
+// sources sharing a host each wait until fewer than their own limit are in flight, so the host
+// never sees more requests than the largest limit.
+func (l *hostLimiter) acquire(ctx context.Context, limit int) error {
+	if limit < 1 {
+		limit = 1
+	}
+	for {
+		l.mu.Lock()
+		if l.inFlight < limit {
+			l.inFlight++
+			l.mu.Unlock()
+			return nil
+		}
+		released := l.released
+		l.mu.Unlock()
+
+		select {
+		case <-released:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// release frees the slot taken by acquire.
+func (l *hostLimiter) release() {
+	l.mu.Lock()
+	l.inFlight--
+	close(l.released)
+	l.released = make(chan struct{})
+	l.mu.Unlock()
+}
+
+func (l *hostLimiter) setInterval(d time.Duration) {
+	l.mu.Lock()
+	l.interval = d
+	l.mu.Unlock()
+}
+
+// wait blocks until the next request slot of the host.
+func (l *hostLimiter) wait(ctx context.Context) error {
+	l.mu.Lock()
+	now := time.Now()
+	slot := l.next
+	if slot.Before(now) {
+		slot = now
+	}
+	l.next = slot.Add(l.interval)
+	l.mu.Unlock()
+
+	d := time.Until(slot)
+	if d <= 0 {
+		return nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// robotsFor returns the cached robots.txt rules of the URL's host, fetching them when missing
+// or expired. Concurrent callers share one fetch, which goes through the host's limiter.
+// A missing or unreachable robots.txt allows everything; one answered with 5xx returns
+// ErrRobotsUnavailable for a while, so nothing is fetched from a host that may forbid it.
+func (f *Fetcher) robotsFor(ctx context.Context, u *url.URL, lim *hostLimiter, maxConcurrency int) (*robotsRules, error) {
+	key := u.Scheme + "://" + u.Host
+	for {
+		f.mu.Lock()
+		if entry, ok := f.robots[key]; ok && time.Since(entry.fetchedAt) < entry.ttl {
+			f.mu.Unlock()
+			return entry.rules, entry.err
+		}
+		if loading, ok := f.robotsLoading[key]; ok {
+			f.mu.Unlock()
+			select {
+			case <-loading:
+				continue
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		loading := make(chan struct{})
+		f.robotsLoading[key] = loading
+		f.mu.Unlock()
+
+		entry, keep := f.loadRobots(ctx, key, u.Host, lim, maxConcurrency)
+
+		f.mu.Lock()
+		if keep {
+			f.robots[key] = entry
+		}
+		delete(f.robotsLoading, key)
+		close(loading)
+		f.mu.Unlock()
+		return entry.rules, entry.err
+	}
+}
+
+// loadRobots fetches the robots.txt of key; keep is false when the result must not be cached.
+func (f *Fetcher) loadRobots(ctx context.Context, key, host string, lim *hostLimiter, maxConcurrency int) (entry *robotsEntry, keep bool) {
+	entry = &robotsEntry{rules: allowAll, fetchedAt: time.Now(), ttl: f.robotsTTL}
+	resp, err := f.limited(ctx, lim, maxConcurrency, key+"/robots.txt", nil)
+	switch {
+	case err != nil:
+		if ctx.Err() != nil {
+			// 任务被取消时不缓存结果
+			return entry, false
+		}
+		f.logf("robots.txt of %s unavailable, allowing all: %v", host, err)
+	case resp.StatusCode >= 500:
+		// 服务器出错时 robots.txt 可能禁止抓取，暂时按全部禁止处理，稍后再取
+		f.logf("robots.txt of %s answered %d, pausing the host for %s", host, resp.StatusCode, robotsRetryAfter)
+		entry.rules, entry.err = nil, fmt.Errorf("%w: status %d", ErrRobotsUnavailable, resp.StatusCode)
+		if f.robotsTTL <= 0 || robotsRetryAfter < f.robotsTTL {
+			entry.ttl = robotsRetryAfter
+		}
+	case resp.StatusCode == http.StatusOK:
+		entry.rules = parseRobots(bytes.NewReader(resp.Body), f.userAgent)
+	}
+	return entry, true
+}
+
+func (f *Fetcher) logf(format string, args ...any) {
+	if f.logger != nil {
+		f.logger.Printf(format, args...)
+	}
+}
@@ -0,0 +1,104 @@
+package crawler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"recommand/internal/config"
+)
+
+func newTestFetcher(respectRobots bool) *Fetcher {
+	return NewFetcher(config.CrawlerConfig{
+		RequestTimeout: 5 * time.Second,
+		UserAgent:      "RecommandBot/1.0",
+		RespectRobots:  respectRobots,
+		RobotsCacheTTL: time.Hour,
+	}, nil, nil)
+}
+
+func TestFetcherBoundsHostConcurrencyAcrossSources(t *testing.T) {
+	var inFlight, peak int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&inFlight, 1)
+		for {
+			p := atomic.LoadInt32(&peak)
+			if n <= p || atomic.CompareAndSwapInt32(&peak, p, n) {
+				break
+			}
+		}
+		time.Sleep(20 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	}))
+	defer srv.Close()
+
+	f := newTestFetcher(false)
+	var wg sync.WaitGroup
+	// 两个来源共用一个站点，并发上限分别为 2 和 3
+	for i := 0; i < 30; i++ {
+		limit := 2 + i%2
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := f.Fetch(context.Background(), srv.URL+"/a", limit); err != nil {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	if peak > 3 {
+		t.Fatalf("peak in-flight requests = %d, want at most 3", peak)
+	}
+}
+
+func TestFetcherRobots(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		wantErr error
+	}{
+		{"allowed", http.StatusOK, "User-agent: *\nDisallow: /private\n", nil},
+		{"disallowed", http.StatusOK, "User-agent: *\nDisallow: /\n", ErrDisallowedByRobots},
+		{"missing robots allows all", http.StatusNotFound, "", nil},
+		{"server error disallows for now", http.StatusServiceUnavailable, "", ErrRobotsUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var robotsHits int32
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/robots.txt" {
+					atomic.AddInt32(&robotsHits, 1)
+					time.Sleep(20 * time.Millisecond)
+					w.WriteHeader(tt.status)
+					w.Write([]byte(tt.body))
+					return
+				}
+				w.Write([]byte("ok"))
+			}))
+			defer srv.Close()
+
+			f := newTestFetcher(true)
+			var wg sync.WaitGroup
+			for i := 0; i < 8; i++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					_, err := f.Fetch(context.Background(), srv.URL+"/news/1.html", 4)
+					if !errors.Is(err, tt.wantErr) {
+						t.Errorf("Fetch error = %v, want %v", err, tt.wantErr)
+					}
+				}()
+			}
+			wg.Wait()
+			if robotsHits != 1 {
+				t.Errorf("robots.txt fetched %d times, want once", robotsHits)
+			}
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package crawler
+
+import (
+	"net/url"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+
+	"recommand/internal/content"
+)
+
+// articlePathPattern matches paths that usually point to a single article on the
+// news sites we crawl, e.g. /n1/2024/0305/c1011-40189134.html or /2024-03/05/c_1130084851.htm.
+var articlePathPattern = regexp.MustCompile(`(/20\d{2}[-/]?\d{2}|/c\d+-\d+|/c_\d+|/content_\d+)`)
+
+// nextPageTexts are anchor texts used by list pages for the "next page" link.
+var nextPageTexts = []string{"下一页", "下页", "下一頁", "next", "next page", "»", "›", ">"}
+
+// articleLink is an article URL discovered on a list page.
+type articleLink struct {
+	URL    string
+	Anchor string
+	// ListedAt is the date shown next to the link (or encoded in its URL); zero if unknown.
+	ListedAt time.Time
+	// DateOnly is set when ListedAt carries no time of day.
+	DateOnly bool
+}
+
+// olderThan reports whether the link is known to be listed before cutoff.
+// Date-only listings count until the end of their day.
+func (l articleLink) olderThan(cutoff time.Time) bool {
+	if l.ListedAt.IsZero() || cutoff.IsZero() {
+		return false
+	}
+	end := l.ListedAt
+	if l.DateOnly {
+		end = end.AddDate(0, 0, 1)
+	}
+	return end.Before(cutoff)
+}
+
+// pastCutoff reports whether a list page has reached the cutoff: most of its dated links are
+// listed before it. A single old item, e.g. in a "related" sidebar, does not end the paging.
+func pastCutoff(links []articleLink, cutoff time.Time) bool {
+	var dated, older int
+	for _, l := range links {
+		if l.ListedAt.IsZero() {
+			continue
+		}
+		dated++
+		if l.olderThan(cutoff) {
+			older++
+		}
+	}
+	return dated > 0 && older*2 > dated
+}
+
+// extractArticleLinks returns absolute, de-duplicated article links found on a list page.
+// Without patterns only links on the same site (registrable domain) as the list page that
+// look like article pages are kept; with patterns every link matching one of them is kept.
+func extractArticleLinks(doc *goquery.Document, base *url.URL, patterns []*regexp.Regexp) []articleLink {
+	var links []articleLink
+	seen := map[string]struct{}{}
+	doc.Find("a[href]").Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		u := resolveLink(base, href)
+		if u == nil {
+			return
+		}
+		if len(patterns) > 0 {
+			if !matchesAny(patterns, u.String()) {
+				return
+			}
+		} else if !sameSite(base, u) || !looksLikeArticle(u) {
+			return
+		}
+		link := u.String()
+		if link == base.String() {
+			return
+		}
+		if _, ok := seen[link]; ok {
+			return
+		}
+		seen[link] = struct{}{}
+		listedAt, dateOnly := listingDate(s, u)
+		links = append(links, articleLink{
+			URL:      link,
+			Anchor:   strings.TrimSpace(s.Text()),
+			ListedAt: listedAt,
+			DateOnly: dateOnly,
+		})
+	})
+	return links
+}
+
+// listDateURLPattern matches dates encoded in article paths: /n1/2024/0305/, /2024-03/05/, /20240305/.
+var listDateURLPattern = regexp.MustCompile(`/(20\d{2})[-/]?(\d{2})[-/]?(\d{2})/`)
+
+// listingDate looks for a date in the text around the link (its own text, then the
+// enclosing list item) and falls back to the date encoded in the URL.
+// dateOnly is set when no time of day was found.
+func listingDate(s *goquery.Selection, u *url.URL) (t time.Time, dateOnly bool) {
+	now := time.Now()
+	texts := []string{s.Text(), s.Closest("li, tr, dd, .item").Text()}
+	// 父节点只包含这一条链接时，它的文本里的日期才属于这条链接
+	if parent := s.Parent(); parent.Find("a").Length() == 1 {
+		texts = append(texts, parent.Text())
+	}
+	for _, text := range texts {
+		if m, ok := content.FindDate(text, now); ok {
+			return m.Time, !m.HasClock
+		}
+	}
+	if m := listDateURLPattern.FindStringSubmatch(u.Path); m != nil {
+		if m, ok := content.FindDate(m[1]+"-"+m[2]+"-"+m[3], now); ok {
+			return m.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// findNextPage returns the absolute URL of the next list page, or "" if there is none.
+func findNextPage(doc *goquery.Document, base *url.URL) string {
+	if href, ok := doc.Find(`link[rel="next"], a[rel="next"]`).First().Attr("href"); ok {
+		if u := resolveLink(base, href); u != nil && sameSite(base, u) {
+			return u.String()
+		}
+	}
+
+	var next string
+	doc.Find("a[href]").EachWithBreak(func(_ int, s *goquery.Selection) bool {
+		text := strings.ToLower(strings.TrimSpace(s.Text()))
+		for _, t := range nextPageTexts {
+			if text != t {
+				continue
+			}
+			href, _ := s.Attr("href")
+			if u := resolveLink(base, href); u != nil && sameSite(base, u) && u.String() != base.String() {
+				next = u.String()
+				return false
+			}
+		}
+		return true
+	})
+	return next
+}
+
+// resolveLink resolves href against base and drops fragments and non-http links.
+func resolveLink(base *url.URL, href string) *url.URL {
+	href = strings.TrimSpace(href)
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(strings.ToLower(href), "javascript:") {
+		return nil
+	}
+	u, err := base.Parse(href)
+	if err != nil {
+		return nil
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil
+	}
+	u.Fragment = ""
+	return u
+}
+
+// sameSite reports whether two URLs share the same registrable domain,
+// so that list pages on military.people.com.cn may link to www.people.com.cn.
+func sameSite(a, b *url.URL) bool {
+	return siteOf(a.Hostname()) == siteOf(b.Hostname())
+}
+
+func siteOf(host string) string {
+	parts := strings.Split(strings.ToLower(host), ".")
+	n := 2
+	// 处理 com.cn / gov.cn 这类二级后缀
+	if len(parts) >= 3 {
+		switch parts[len(parts)-2] {
+		case "com", "net", "org", "gov", "edu":
+			n = 3
+		}
+	}
+	if len(parts) <= n {
+		return strings.Join(parts, ".")
+	}
+	return strings.Join(parts[len(parts)-n:], ".")
+}
+
+func looksLikeArticle(u *url.URL) bool {
+	p := u.Path
+	base := strings.ToLower(path.Base(p))
+	if strings.HasPrefix(base, "index") || strings.HasPrefix(base, "list") {
+		return false
+	}
+	switch strings.ToLower(path.Ext(p)) {
+	case ".html", ".htm", ".shtml":
+	default:
+		return false
+	}
+	return articlePathPattern.MatchString(p)
+}
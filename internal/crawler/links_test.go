@@ -0,0 +1,36 @@
+package crawler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestPastCutoff(t *testing.T) {
+	cutoff := time.Date(2024, 3, 5, 12, 0, 0, 0, time.UTC)
+	fresh := articleLink{URL: "https://example.com/a", ListedAt: cutoff.Add(time.Hour)}
+	old := articleLink{URL: "https://example.com/b", ListedAt: cutoff.Add(-48 * time.Hour)}
+	undated := articleLink{URL: "https://example.com/c"}
+	sameDay := articleLink{URL: "https://example.com/d", ListedAt: time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC), DateOnly: true}
+
+	tests := []struct {
+		name  string
+		links []articleLink
+		want  bool
+	}{
+		{"no links", nil, false},
+		{"only undated", []articleLink{undated, undated}, false},
+		{"all fresh", []articleLink{fresh, fresh}, false},
+		{"one old sidebar item", []articleLink{fresh, fresh, fresh, old}, false},
+		{"half old", []articleLink{fresh, old}, false},
+		{"mostly old", []articleLink{fresh, old, old, undated}, true},
+		{"all old", []articleLink{old, old}, true},
+		{"date-only same day is not old", []articleLink{sameDay, sameDay}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := pastCutoff(tt.links, cutoff); got != tt.want {
+				t.Errorf("pastCutoff = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
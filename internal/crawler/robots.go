@@ -0,0 +1,160 @@
+package crawler
+
+import (
+	"bufio"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// robotsRules is the group of a robots.txt that applies to our User-Agent.
+type robotsRules struct {
+	allow      []string
+	disallow   []string
+	crawlDelay time.Duration
+}
+
+// allowAll is used when a site has no robots.txt or it cannot be fetched.
+var allowAll = &robotsRules{}
+
+// parseRobots parses robots.txt and keeps the group whose User-agent is the product token
+// of userAgent (compared case-insensitively, as in RFC 9309), falling back to the "*" group.
+func parseRobots(r io.Reader, userAgent string) *robotsRules {
+	token := productToken(userAgent)
+
+	var (
+		specific, wildcard *robotsRules
+		current            []*robotsRules
+		inAgents           bool
+	)
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		value = strings.TrimSpace(value)
+
+		if key == "user-agent" {
+			if !inAgents {
+				current = nil
+				inAgents = true
+			}
+			agent := productToken(value)
+			switch {
+			case value == "*":
+				if wildcard == nil {
+					wildcard = &robotsRules{}
+				}
+				current = append(current, wildcard)
+			case agent != "" && agent == token:
+				if specific == nil {
+					specific = &robotsRules{}
+				}
+				current = append(current, specific)
+			}
+			continue
+		}
+		inAgents = false
+
+		for _, g := range current {
+			switch key {
+			case "allow":
+				if value != "" {
+					g.allow = append(g.allow, value)
+				}
+			case "disallow":
+				// 空的 Disallow 表示允许全部
+				if value != "" {
+					g.disallow = append(g.disallow, value)
+				}
+			case "crawl-delay":
+				if secs, err := strconv.ParseFloat(value, 64); err == nil && secs > 0 {
+					g.crawlDelay = time.Duration(secs * float64(time.Second))
+				}
+			}
+		}
+	}
+
+	switch {
+	case specific != nil:
+		return specific
+	case wildcard != nil:
+		return wildcard
+	default:
+		return allowAll
+	}
+}
+
+// productToken returns the lowercased name of a User-Agent, e.g. "recommandbot" for
+// "RecommandBot/1.0 (+https://example.com)".
+func productToken(userAgent string) string {
+	token := strings.ToLower(strings.TrimSpace(userAgent))
+	if i := strings.IndexAny(token, "/ "); i >= 0 {
+		token = token[:i]
+	}
+	return token
+}
+
+// allowed reports whether a path (with query) may be fetched.
+// The longest matching rule wins and Allow wins ties, as in RFC 9309.
+func (r *robotsRules) allowed(path string) bool {
+	if path == "" {
+		path = "/"
+	}
+	best, allow := -1, true
+	for _, p := range r.disallow {
+		if n := robotsMatch(p, path); n > best {
+			best, allow = n, false
+		}
+	}
+	for _, p := range r.allow {
+		if n := robotsMatch(p, path); n >= best && n >= 0 {
+			best, allow = n, true
+		}
+	}
+	return allow
+}
+
+// robotsMatch returns the pattern length when pattern matches path, -1 otherwise.
+// It supports the "*" wildcard and the "$" end anchor.
+func robotsMatch(pattern, path string) int {
+	anchored := strings.HasSuffix(pattern, "$")
+	p := strings.TrimSuffix(pattern, "$")
+
+	parts := strings.Split(p, "*")
+	pos := 0
+	for i, part := range parts {
+		if i == 0 {
+			if !strings.HasPrefix(path, part) {
+				return -1
+			}
+			pos = len(part)
+			continue
+		}
+		idx := strings.Index(path[pos:], part)
+		if idx < 0 {
+			return -1
+		}
+		pos += idx + len(part)
+	}
+	if anchored {
+		// "$" 要求最后一段正好匹配到路径结尾
+		last := parts[len(parts)-1]
+		if len(parts) == 1 {
+			if path != p {
+				return -1
+			}
+		} else if !strings.HasSuffix(path, last) {
+			return -1
+		}
+	}
+	return len(pattern)
+}
@@ -0,0 +1,122 @@
+package crawler
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseRobots(t *testing.T) {
+	const robots = `
+# comment
+User-agent: *
+Disallow: /private/
+Allow: /private/open
+Crawl-delay: 2
+
+User-agent: otherbot
+Disallow: /
+
+User-agent: RecommandBot
+User-agent: anotherbot
+Disallow: /search
+Disallow: /*.pdf$
+Allow: /search/about
+Crawl-delay: 0.5
+`
+	tests := []struct {
+		name      string
+		userAgent string
+		path      string
+		want      bool
+	}{
+		{"wildcard group allows other paths", "SomeBot/1.0", "/news/1.html", true},
+		{"wildcard group disallows prefix", "SomeBot/1.0", "/private/a", false},
+		{"longer allow wins", "SomeBot/1.0", "/private/open/1", true},
+		{"specific group replaces wildcard", "RecommandBot/1.0 (+https://example.com)", "/private/a", true},
+		{"specific disallow", "RecommandBot/1.0", "/search?q=1", false},
+		{"specific allow wins", "RecommandBot/1.0", "/search/about", true},
+		{"end anchor matches", "RecommandBot/1.0", "/files/a.pdf", false},
+		{"end anchor needs end", "RecommandBot/1.0", "/files/a.pdf?x=1", true},
+		{"empty path is root", "RecommandBot/1.0", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rules := parseRobots(strings.NewReader(robots), tt.userAgent)
+			if got := rules.allowed(tt.path); got != tt.want {
+				t.Errorf("allowed(%q) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+
+	if d := parseRobots(strings.NewReader(robots), "SomeBot").crawlDelay; d != 2*time.Second {
+		t.Errorf("wildcard crawl delay = %s, want 2s", d)
+	}
+	if d := parseRobots(strings.NewReader(robots), "RecommandBot").crawlDelay; d != 500*time.Millisecond {
+		t.Errorf("specific crawl delay = %s, want 500ms", d)
+	}
+	if rules := parseRobots(strings.NewReader(""), "RecommandBot"); rules != allowAll {
+		t.Errorf("empty robots.txt = %+v, want allowAll", rules)
+	}
+}
+
+func TestParseRobotsAgentMatch(t *testing.T) {
+	tests := []struct {
+		name      string
+		robots    string
+		userAgent string
+		want      bool
+	}{
+		{"exact token", "User-agent: *\nDisallow: /\n\nUser-agent: RecommandBot\nAllow: /\n", "RecommandBot/1.0", true},
+		{"case-insensitive token", "User-agent: *\nDisallow: /\n\nUser-agent: recommandbot\nAllow: /\n", "RecommandBot/1.0", true},
+		{"token with version", "User-agent: *\nDisallow: /\n\nUser-agent: RecommandBot/2.0\nAllow: /\n", "RecommandBot/1.0", true},
+		{"one-letter agent is not ours", "User-agent: *\nAllow: /\n\nUser-agent: r\nDisallow: /\n", "RecommandBot/1.0", true},
+		{"substring agent is not ours", "User-agent: *\nAllow: /\n\nUser-agent: Bot\nDisallow: /\n", "RecommandBot/1.0", true},
+		{"longer agent is not ours", "User-agent: *\nAllow: /\n\nUser-agent: RecommandBotPro\nDisallow: /\n", "RecommandBot/1.0", true},
+		{"empty agent is skipped", "User-agent:\nDisallow: /\n\nUser-agent: *\nAllow: /\n", "RecommandBot/1.0", true},
+		{"empty agent does not join the wildcard group", "User-agent: *\nUser-agent:\nDisallow: /a\n", "RecommandBot/1.0", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := parseRobots(strings.NewReader(tt.robots), tt.userAgent).allowed("/a"); got != tt.want {
+				t.Errorf("allowed(/a) = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestProductToken(t *testing.T) {
+	tests := []struct{ in, want string }{
+		{"RecommandBot/1.0 (+https://example.com)", "recommandbot"},
+		{" RecommandBot ", "recommandbot"},
+		{"/1.0", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := productToken(tt.in); got != tt.want {
+			t.Errorf("productToken(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          int
+	}{
+		{"/a", "/a/b", 2},
+		{"/a", "/b", -1},
+		{"/*.php", "/x/index.php?q", 6},
+		{"/*.php$", "/x/index.php", 7},
+		{"/*.php$", "/x/index.php?q", -1},
+		{"/a$", "/a", 3},
+		{"/a$", "/ab", -1},
+		{"/a*b*c", "/a-b-c", 6},
+		{"/a*b*c", "/a-c-b", -1},
+	}
+	for _, tt := range tests {
+		if got := robotsMatch(tt.pattern, tt.path); got != tt.want {
+			t.Errorf("robotsMatch(%q, %q) = %d, want %d", tt.pattern, tt.path, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package domain
+
+import "time"
+
+// Kinds of frontier entries.
+const (
+	// FrontierListing is a list page, feed or sitemap.
+	FrontierListing = "listing"
+	// FrontierArticle is an article page.
+	FrontierArticle = "article"
+)
+
+// States of frontier entries.
+const (
+	FrontierPending  = "pending"
+	FrontierFetching = "fetching"
+	FrontierDone     = "done"
+	FrontierFailed   = "failed"
+	// FrontierSkipped marks articles older than the incremental cutoff or already stored.
+	FrontierSkipped = "skipped"
+	// FrontierUnchanged marks URLs answered with 304 Not Modified on a conditional request.
+	FrontierUnchanged = "unchanged"
+)
+
+// Failure classes recorded in FrontierEntry.FailureClass.
+const (
+	FailureDNS         = "dns"
+	FailureTimeout     = "timeout"
+	FailureNetwork     = "network"
+	FailureHTTP4xx     = "http_4xx"
+	FailureHTTP5xx     = "http_5xx"
+	FailureRateLimited = "http_429"
+	FailureParse       = "parse"
+	FailureRobots      = "robots"
+	FailureTooLarge    = "too_large"
+	FailureOther       = "other"
+)
+
+// Downstream outcomes of fetched articles, recorded in FrontierEntry.Outcome by the
+// pipeline stages after the crawler.
+const (
+	// OutcomeSaved is set by news-sink when the article was inserted into news.
+	OutcomeSaved = "saved"
+	// OutcomeDuplicate is set by news-sink when news already had an article with the same hash.
+	OutcomeDuplicate = "duplicate"
+	// OutcomeParseFailed is set by parsed-producer when the page could not be parsed.
+	OutcomeParseFailed = "parse_failed"
+	// OutcomeProduceFailed is set by parsed-producer when it gave up on a page for another
+	// reason, e.g. news.parsed could not be written, and dead-lettered it.
+	OutcomeProduceFailed = "produce_failed"
+	// OutcomeSinkFailed is set by news-sink when it gave up on an article and dead-lettered it.
+	OutcomeSinkFailed = "sink_failed"
+)
+
+// FrontierEntry is a URL discovered by a crawl task. The frontier of a task is its
+// checkpoint: a restarted task resumes from its pending entries.
+type FrontierEntry struct {
+	TaskID string `db:"task_id" json:"task_id"`
+	URL    string `db:"url" json:"url"`
+	Kind   string `db:"kind" json:"kind"`
+	// Depth is 0 for the start listings, listing depth+1 for the next page or child
+	// sitemap of a listing, and listing depth+1 for the articles found on it.
+	Depth     int        `db:"depth" json:"depth"`
+	State     string     `db:"state" json:"state"`
+	Attempts  int        `db:"attempts" json:"attempts"`
+	Anchor    string     `db:"anchor" json:"anchor,omitempty"`
+	ListedAt  *time.Time `db:"listed_at" json:"listed_at,omitempty"`
+	ListURL   string     `db:"list_url" json:"list_url,omitempty"`
+	LastError *string    `db:"last_error" json:"last_error,omitempty"`
+	// FailureClass is set for failed entries, e.g. "http_4xx" or "timeout".
+	FailureClass *string `db:"failure_class" json:"failure_class,omitempty"`
+	// Outcome is what the pipeline did with a fetched article, e.g. "saved" or "duplicate".
+	Outcome   *string   `db:"outcome" json:"outcome,omitempty"`
+	CreatedAt time.Time `db:"created_at" json:"created_at"`
+	UpdatedAt time.Time `db:"updated_at" json:"updated_at"`
+}
@@ -3,17 +3,54 @@ package domain
 import "time"
 
 type NewsSource struct {
-	ID               int64      `db:"id" json:"id"`
-	Name             string     `db:"name" json:"name"`
-	Code             string     `db:"code" json:"code"`
-	BaseURL          string     `db:"base_url" json:"base_url"`
-	Language         string     `db:"language" json:"language"`
-	Category         string     `db:"category" json:"category"`
-	Enabled          bool       `db:"enabled" json:"enabled"`
-	CrawlIntervalMin int        `db:"crawl_interval_minutes" json:"crawl_interval_minutes"`
-	MaxConcurrency   int        `db:"max_concurrency" json:"max_concurrency"`
-	LastCrawlAt      *time.Time `db:"last_crawl_at" json:"last_crawl_at,omitempty"`
-	LastCrawlStatus  *string    `db:"last_crawl_status" json:"last_crawl_status,omitempty"`
-	CreatedAt        time.Time  `db:"created_at" json:"created_at"`
-	UpdatedAt        time.Time  `db:"updated_at" json:"updated_at"`
+	ID               int64            `db:"id" json:"id"`
+	Name             string           `db:"name" json:"name"`
+	Code             string           `db:"code" json:"code"`
+	BaseURL          string           `db:"base_url" json:"base_url"`
+	Language         string           `db:"language" json:"language"`
+	Category         string           `db:"category" json:"category"`
+	Enabled          bool             `db:"enabled" json:"enabled"`
+	CrawlIntervalMin int              `db:"crawl_interval_minutes" json:"crawl_interval_minutes"`
+	MaxConcurrency   int              `db:"max_concurrency" json:"max_concurrency"`
+	LastCrawlAt      *time.Time       `db:"last_crawl_at" json:"last_crawl_at,omitempty"`
+	LastCrawlStatus  *string          `db:"last_crawl_status" json:"last_crawl_status,omitempty"`
+	ExtractionRules  *ExtractionRules `db:"extraction_rules" json:"extraction_rules,omitempty"`
+	Discovery        *Discovery       `db:"discovery" json:"discovery,omitempty"`
+	CreatedAt        time.Time        `db:"created_at" json:"created_at"`
+	UpdatedAt        time.Time        `db:"updated_at" json:"updated_at"`
+}
+
+// ExtractionRules tell the rule-driven parser how to read the article pages of a source.
+// Selectors are CSS selectors tried in order; DateLayouts are Go time layouts.
+type ExtractionRules struct {
+	TitleSelectors       []string `json:"title_selectors,omitempty"`
+	BodySelectors        []string `json:"body_selectors,omitempty"`
+	PublishTimeSelectors []string `json:"publish_time_selectors,omitempty"`
+	AuthorSelectors      []string `json:"author_selectors,omitempty"`
+	EditorSelectors      []string `json:"editor_selectors,omitempty"`
+	OriginSelectors      []string `json:"origin_selectors,omitempty"`
+	ImageSelectors       []string `json:"image_selectors,omitempty"`
+	DateLayouts          []string `json:"date_layouts,omitempty"`
+	RemoveSelectors      []string `json:"remove_selectors,omitempty"`
+}
+
+// Discovery methods of a source.
+const (
+	// DiscoveryHTML walks HTML list pages and follows their "next page" links.
+	DiscoveryHTML = "html"
+	// DiscoveryFeed reads RSS or Atom feeds.
+	DiscoveryFeed = "feed"
+	// DiscoverySitemap reads XML sitemaps, including news sitemaps and sitemap indexes.
+	DiscoverySitemap = "sitemap"
+)
+
+// Discovery tells the crawler where a source lists its articles. A source without
+// discovery settings walks the HTML list pages starting at BaseURL.
+type Discovery struct {
+	Method string `json:"method"`
+	// URLs are the list pages, feeds or sitemaps to read; BaseURL when empty.
+	URLs []string `json:"urls,omitempty"`
+	// LinkPatterns are regular expressions matched against absolute article URLs.
+	// When set they replace the built-in article link heuristics.
+	LinkPatterns []string `json:"link_patterns,omitempty"`
 }
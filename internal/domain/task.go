@@ -19,6 +19,30 @@ const (
 	StatusStopped   CrawlStatus = "stopped"
 )
 
+// TaskStage is where a running task is in the pipeline.
+type TaskStage string
+
+const (
+	// StageFetching: the engine is fetching listings and articles into news.raw.
+	StageFetching TaskStage = "fetching"
+	// StageAwaitingParse: fetching is over, the task waits until parsed-producer and news-sink
+	// have handled all its raw messages.
+	StageAwaitingParse TaskStage = "awaiting_parse"
+	// StageDone: the task reached a final status.
+	StageDone TaskStage = "done"
+)
+
+// Reasons recorded in CrawlTask.StopReason when a crawl stops paging.
+const (
+	StopReasonMaxPages      = "max_pages"
+	StopReasonNoNextPage    = "no_next_page"
+	StopReasonReachedCutoff = "reached_cutoff"
+	StopReasonListPageError = "list_page_error"
+	StopReasonStopped       = "stopped"
+	// StopReasonNotModified means a list page was unchanged since the previous crawl.
+	StopReasonNotModified = "not_modified"
+)
+
 type CrawlTask struct {
 	TaskID            string      `db:"task_id" json:"task_id"`
 	SourceID          int64       `db:"source_id" json:"source_id"`
@@ -27,6 +51,7 @@ type CrawlTask struct {
 	Since             *time.Time  `db:"since" json:"since,omitempty"`
 	MaxPages          *int        `db:"max_pages" json:"max_pages,omitempty"`
 	Status            CrawlStatus `db:"status" json:"status"`
+	Stage             TaskStage   `db:"stage" json:"stage"`
 	Progress          float64     `db:"progress" json:"progress"`
 	PagesCrawled      int         `db:"pages_crawled" json:"pages_crawled"`
 	ArticlesFound     int         `db:"articles_found" json:"articles_found"`
@@ -36,7 +61,16 @@ type CrawlTask struct {
 	StartedAt         *time.Time  `db:"started_at" json:"started_at,omitempty"`
 	CompletedAt       *time.Time  `db:"completed_at" json:"completed_at,omitempty"`
 	ErrorMessage      *string     `db:"error_message" json:"error_message,omitempty"`
-	CreatedBy         *int64      `db:"created_by" json:"created_by,omitempty"`
-	CreatedAt         time.Time   `db:"created_at" json:"created_at"`
-	UpdatedAt         time.Time   `db:"updated_at" json:"updated_at"`
+	LastPageURL       *string     `db:"last_page_url" json:"last_page_url,omitempty"`
+	StopReason        *string     `db:"stop_reason" json:"stop_reason,omitempty"`
+	// NotModified counts the URLs answered with 304 Not Modified; BytesFetched the body bytes downloaded.
+	NotModified  int   `db:"not_modified" json:"not_modified"`
+	BytesFetched int64 `db:"bytes_fetched" json:"bytes_fetched"`
+	// RawMessages counts the article pages written into news.raw.
+	RawMessages int `db:"raw_messages" json:"raw_messages"`
+	// HeartbeatAt is refreshed while an engine runs the task; a stale heartbeat marks an orphaned task.
+	HeartbeatAt *time.Time `db:"heartbeat_at" json:"heartbeat_at,omitempty"`
+	CreatedBy   *int64     `db:"created_by" json:"created_by,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	UpdatedAt   time.Time  `db:"updated_at" json:"updated_at"`
 }
@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"recommand/internal/content"
+)
+
+type ParserHandler struct {
+	registry *content.Registry
+}
+
+func NewParserHandler(registry *content.Registry) *ParserHandler {
+	return &ParserHandler{registry: registry}
+}
+
+// ListParsers GET /api/v1/crawler/parsers
+func (h *ParserHandler) ListParsers(c *gin.Context) {
+	parsers := h.registry.List()
+	c.JSON(http.StatusOK, gin.H{"items": parsers, "total": len(parsers)})
+}
@@ -6,6 +6,8 @@ import (
 
 	"github.com/gin-gonic/gin"
 
+	"recommand/internal/content"
+	"recommand/internal/crawler"
 	"recommand/internal/domain"
 	"recommand/internal/repository"
 )
@@ -29,14 +31,16 @@ func (h *SourceHandler) ListSources(c *gin.Context) {
 }
 
 type CreateSourceRequest struct {
-	Name             string `json:"name" binding:"required"`
-	Code             string `json:"code" binding:"required"`
-	BaseURL          string `json:"base_url" binding:"required"`
-	Language         string `json:"language" binding:"required"`
-	Category         string `json:"category" binding:"required"`
-	Enabled          bool   `json:"enabled"`
-	CrawlIntervalMin int    `json:"crawl_interval_minutes" binding:"gte=1"`
-	MaxConcurrency   int    `json:"max_concurrency" binding:"gte=1"`
+	Name             string                  `json:"name" binding:"required"`
+	Code             string                  `json:"code" binding:"required"`
+	BaseURL          string                  `json:"base_url" binding:"required"`
+	Language         string                  `json:"language" binding:"required"`
+	Category         string                  `json:"category" binding:"required"`
+	Enabled          bool                    `json:"enabled"`
+	CrawlIntervalMin int                     `json:"crawl_interval_minutes" binding:"gte=1"`
+	MaxConcurrency   int                     `json:"max_concurrency" binding:"gte=1"`
+	ExtractionRules  *domain.ExtractionRules `json:"extraction_rules"` // 可选，配置后优先于内置解析器
+	Discovery        *domain.Discovery       `json:"discovery"`        // 可选，默认从 base_url 翻列表页
 }
 
 // CreateSource POST /api/v1/crawler/sources
@@ -46,6 +50,18 @@ func (h *SourceHandler) CreateSource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.ExtractionRules != nil {
+		if err := content.ValidateRules(*req.ExtractionRules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Discovery != nil {
+		if err := crawler.ValidateDiscovery(*req.Discovery); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	ns := &domain.NewsSource{
 		Name:             req.Name,
@@ -56,6 +72,8 @@ func (h *SourceHandler) CreateSource(c *gin.Context) {
 		Enabled:          req.Enabled,
 		CrawlIntervalMin: req.CrawlIntervalMin,
 		MaxConcurrency:   req.MaxConcurrency,
+		ExtractionRules:  req.ExtractionRules,
+		Discovery:        req.Discovery,
 	}
 
 	if err := h.repo.Create(c.Request.Context(), ns); err != nil {
@@ -66,14 +84,16 @@ func (h *SourceHandler) CreateSource(c *gin.Context) {
 }
 
 type UpdateSourceRequest struct {
-	Name             string `json:"name" binding:"required"`
-	Code             string `json:"code" binding:"required"`
-	BaseURL          string `json:"base_url" binding:"required"`
-	Language         string `json:"language" binding:"required"`
-	Category         string `json:"category" binding:"required"`
-	Enabled          bool   `json:"enabled"`
-	CrawlIntervalMin int    `json:"crawl_interval_minutes" binding:"gte=1"`
-	MaxConcurrency   int    `json:"max_concurrency" binding:"gte=1"`
+	Name             string                  `json:"name" binding:"required"`
+	Code             string                  `json:"code" binding:"required"`
+	BaseURL          string                  `json:"base_url" binding:"required"`
+	Language         string                  `json:"language" binding:"required"`
+	Category         string                  `json:"category" binding:"required"`
+	Enabled          bool                    `json:"enabled"`
+	CrawlIntervalMin int                     `json:"crawl_interval_minutes" binding:"gte=1"`
+	MaxConcurrency   int                     `json:"max_concurrency" binding:"gte=1"`
+	ExtractionRules  *domain.ExtractionRules `json:"extraction_rules"` // 可选，配置后优先于内置解析器
+	Discovery        *domain.Discovery       `json:"discovery"`        // 可选，默认从 base_url 翻列表页
 }
 
 // UpdateSource PUT /api/v1/crawler/sources/:id
@@ -100,6 +120,18 @@ func (h *SourceHandler) UpdateSource(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if req.ExtractionRules != nil {
+		if err := content.ValidateRules(*req.ExtractionRules); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if req.Discovery != nil {
+		if err := crawler.ValidateDiscovery(*req.Discovery); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
 
 	existing.Name = req.Name
 	existing.Code = req.Code
@@ -109,6 +141,8 @@ func (h *SourceHandler) UpdateSource(c *gin.Context) {
 	existing.Enabled = req.Enabled
 	existing.CrawlIntervalMin = req.CrawlIntervalMin
 	existing.MaxConcurrency = req.MaxConcurrency
+	existing.ExtractionRules = req.ExtractionRules
+	existing.Discovery = req.Discovery
 
 	if err := h.repo.Update(c.Request.Context(), existing); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
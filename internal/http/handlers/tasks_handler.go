@@ -4,6 +4,7 @@ import (
 	"io"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -73,6 +74,7 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		Since:      sincePtr,
 		MaxPages:   req.MaxPages,
 		Status:     domain.StatusPending,
+		Stage:      domain.StageFetching,
 		Progress:   0,
 		CreatedAt:  time.Now().UTC(),
 		UpdatedAt:  time.Now().UTC(),
@@ -83,8 +85,8 @@ func (h *TaskHandler) CreateTask(c *gin.Context) {
 		return
 	}
 
-	// 启动一个假的爬虫执行流程（后台 goroutine 模拟进度）
-	h.engine.StartFakeTask(task.TaskID)
+	// 后台 goroutine 执行真实抓取：列表页 → 翻页 → 文章页 → news.raw
+	h.engine.StartTask(task.TaskID)
 
 	c.JSON(http.StatusAccepted, task)
 }
@@ -142,10 +144,30 @@ func (h *TaskHandler) StopTask(c *gin.Context) {
 		return
 	}
 
-	// 简单地把状态标记为 stopped，后续实际运行中需要通知执行引擎
-	if err := h.taskRepo.UpdateStatus(c.Request.Context(), id, domain.StatusStopped); err != nil {
+	reason := strings.TrimSpace(req.Reason)
+	if reason == "" {
+		reason = "stopped by user"
+	}
+
+	// 先落库 stopped（只对 pending/running 生效），再通知引擎取消正在进行的抓取
+	ok, err := h.taskRepo.MarkStopped(c.Request.Context(), id, reason)
+	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
 		return
 	}
+	if !ok {
+		task, err := h.taskRepo.GetByID(c.Request.Context(), id)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "internal_error"})
+			return
+		}
+		if task == nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+			return
+		}
+		c.JSON(http.StatusConflict, gin.H{"error": "task_already_finished", "status": task.Status})
+		return
+	}
+	h.engine.Stop(id)
 	c.Status(http.StatusNoContent)
 }
@@ -0,0 +1,94 @@
+package kafka
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+
+	"recommand/internal/config"
+)
+
+// TLSConfig returns the TLS settings of the Kafka connections, or nil for plaintext.
+func TLSConfig(cfg config.KafkaConfig) (*tls.Config, error) {
+	if !cfg.TLSEnabled {
+		return nil, nil
+	}
+	tc := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         cfg.TLSServerName,
+		InsecureSkipVerify: cfg.TLSInsecureSkipVerify,
+	}
+	if cfg.TLSCAFile != "" {
+		pem, err := os.ReadFile(cfg.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read KAFKA_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("KAFKA_TLS_CA_FILE %s contains no PEM certificates", cfg.TLSCAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if cfg.TLSCertFile != "" || cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load KAFKA_TLS_CERT_FILE/KAFKA_TLS_KEY_FILE: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	return tc, nil
+}
+
+// SASLMechanism returns the SASL mechanism of the Kafka connections, or nil without SASL.
+func SASLMechanism(cfg config.KafkaConfig) (sasl.Mechanism, error) {
+	switch strings.ToLower(cfg.SASLMechanism) {
+	case "", "none":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: cfg.SASLUsername, Password: cfg.SASLPassword}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, cfg.SASLUsername, cfg.SASLPassword)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, cfg.SASLUsername, cfg.SASLPassword)
+	}
+	return nil, fmt.Errorf("unknown KAFKA_SASL_MECHANISM %q (none, plain, scram-sha-256, scram-sha-512)", cfg.SASLMechanism)
+}
+
+// Transport returns the transport of writers, with the TLS and SASL settings of cfg.
+func Transport(cfg config.KafkaConfig) (*kafka.Transport, error) {
+	tc, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := SASLMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Transport{TLS: tc, SASL: mechanism}, nil
+}
+
+// Dialer returns the dialer of readers and direct connections, with the TLS and SASL settings of cfg.
+func Dialer(cfg config.KafkaConfig) (*kafka.Dialer, error) {
+	tc, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := SASLMechanism(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &kafka.Dialer{
+		Timeout:       10 * time.Second,
+		DualStack:     true,
+		TLS:           tc,
+		SASLMechanism: mechanism,
+	}, nil
+}
@@ -0,0 +1,203 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+
+	"recommand/internal/config"
+)
+
+// Handler handles one message. A returned error makes the consumer retry the message;
+// once the retries are used up, or right away for errors marked with Permanent, the
+// message is published to the dead-letter topic (or logged and skipped without one).
+type Handler func(ctx context.Context, m kafka.Message) error
+
+// GiveUpFunc is called with a message the consumer gave up on, before it is committed,
+// whether it went to the dead-letter topic or was dropped.
+type GiveUpFunc func(ctx context.Context, m kafka.Message, err error)
+
+// Consumer reads a topic as a member of a consumer group: the partitions of the topic are
+// spread over all members and rebalanced when members join or leave. Offsets are committed
+// only after the handler returned, so a message is handled at least once.
+type Consumer struct {
+	reader  *kafka.Reader
+	retries int
+	// retryDelay is the first wait between retries; it doubles with every retry.
+	retryDelay time.Duration
+	// stage names the consumer in the headers of dead-letter messages.
+	stage    string
+	dlq      *kafka.Writer
+	onGiveUp GiveUpFunc
+	logger   *log.Logger
+}
+
+// NewConsumer joins the consumer group cfg.GroupID, or defaultGroup when it is not set,
+// on topic. A new group starts at the oldest message of the topic. Failed messages are
+// published to dlqTopic with defaultGroup as their stage; an empty dlqTopic drops them.
+// onGiveUp (which may be nil) lets the service record the failure, e.g. in the task of the message.
+func NewConsumer(cfg config.KafkaConfig, topic, dlqTopic, defaultGroup string, onGiveUp GiveUpFunc, logger *log.Logger) (*Consumer, error) {
+	groupID := cfg.GroupID
+	if groupID == "" {
+		groupID = defaultGroup
+	}
+	brokers := cfg.Brokers
+	if len(brokers) == 0 {
+		brokers = []string{"localhost:9092"}
+	}
+	dialer, err := Dialer(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := Transport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers:     brokers,
+		Dialer:      dialer,
+		GroupID:     groupID,
+		Topic:       topic,
+		StartOffset: kafka.FirstOffset,
+		MinBytes:    1,
+		MaxBytes:    10e6,
+		// CommitInterval 为 0 时 CommitMessages 同步提交，处理完成后 offset 立即落到 broker
+		CommitInterval: 0,
+	})
+	c := &Consumer{reader: reader, retries: cfg.HandlerRetries, retryDelay: time.Second, stage: defaultGroup, onGiveUp: onGiveUp, logger: logger}
+	if dlqTopic != "" {
+		// 死信逐条同步写入：BatchSize 为 1 时不等待 BatchTimeout（默认 1s）凑批，毒消息不会拖慢消费
+		c.dlq = &kafka.Writer{
+			Addr:         kafka.TCP(brokers...),
+			Topic:        dlqTopic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    1,
+			RequiredAcks: kafka.RequireAll,
+			Transport:    transport,
+		}
+	}
+	return c, nil
+}
+
+// Run fetches messages and hands them to handle until ctx is done, then returns nil.
+// A message being handled when ctx is cancelled is finished and committed first, so
+// shutting down (or a rebalance after Close) does not hand it to another member again.
+// A message waiting for its next retry is left uncommitted instead, so shutting down does
+// not wait for the backoff; the group hands it out again later.
+func (c *Consumer) Run(ctx context.Context, handle Handler) error {
+	for {
+		m, err := c.reader.FetchMessage(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+			if errors.Is(err, kafka.ErrGroupClosed) {
+				return err
+			}
+			c.logf("fetch from %s: %v", c.reader.Config().Topic, err)
+			if !sleep(ctx, time.Second) {
+				return nil
+			}
+			continue
+		}
+
+		if !c.handle(ctx, m, handle) {
+			c.logf("shutting down, leaving %s partition=%d offset=%d uncommitted", m.Topic, m.Partition, m.Offset)
+			return nil
+		}
+		if err := c.reader.CommitMessages(context.WithoutCancel(ctx), m); err != nil {
+			c.logf("commit %s partition=%d offset=%d: %v", m.Topic, m.Partition, m.Offset, err)
+		}
+	}
+}
+
+// handle runs handle with retries and a growing delay between them, and dead-letters
+// the message when it still fails. Handling and dead-lettering are not cancelled with ctx;
+// it reports false when ctx was done during a wait between retries, before the message
+// was given up, so the message must not be committed.
+func (c *Consumer) handle(ctx context.Context, m kafka.Message, handle Handler) bool {
+	hctx := context.WithoutCancel(ctx)
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		err := handle(hctx, m)
+		if err == nil {
+			return true
+		}
+		if IsPermanent(err) || attempt >= c.retries {
+			if !c.deadLetter(ctx, m, attempt+1, err) {
+				return false
+			}
+			if c.onGiveUp != nil {
+				c.onGiveUp(hctx, m, err)
+			}
+			return true
+		}
+		c.logf("handle %s partition=%d offset=%d failed, retrying in %s: %v", m.Topic, m.Partition, m.Offset, delay, err)
+		if !sleep(ctx, delay) {
+			return false
+		}
+		delay *= 2
+	}
+}
+
+// deadLetter publishes a message that failed for good to the dead-letter topic. Publishing is
+// retried like handling, since the message is committed (and so given up) right afterwards.
+// It reports false when ctx was done while waiting to retry a failed write.
+func (c *Consumer) deadLetter(ctx context.Context, m kafka.Message, attempts int, err error) bool {
+	if c.dlq == nil {
+		c.logf("dropping %s partition=%d offset=%d after %d attempts: %v", m.Topic, m.Partition, m.Offset, attempts, err)
+		return true
+	}
+	c.logf("dead-lettering %s partition=%d offset=%d to %s after %d attempts: %v", m.Topic, m.Partition, m.Offset, c.dlq.Topic, attempts, err)
+	dm := DeadLetter(m, c.stage, attempts, err, time.Now())
+	delay := c.retryDelay
+	for try := 0; ; try++ {
+		werr := c.dlq.WriteMessages(context.WithoutCancel(ctx), dm)
+		if werr == nil {
+			return true
+		}
+		if try >= c.retries {
+			c.logf("dropping %s partition=%d offset=%d, dead-letter write failed: %v", m.Topic, m.Partition, m.Offset, werr)
+			return true
+		}
+		if !sleep(ctx, delay) {
+			return false
+		}
+		delay *= 2
+	}
+}
+
+// sleep waits for d and reports whether it did; it returns false as soon as ctx is done.
+func sleep(ctx context.Context, d time.Duration) bool {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-t.C:
+		return true
+	}
+}
+
+// Close leaves the consumer group, which hands the partitions to the remaining members.
+func (c *Consumer) Close() error {
+	if c == nil {
+		return nil
+	}
+	if c.dlq != nil {
+		if err := c.dlq.Close(); err != nil {
+			c.reader.Close()
+			return err
+		}
+	}
+	return c.reader.Close()
+}
+
+func (c *Consumer) logf(format string, args ...any) {
+	if c.logger != nil {
+		c.logger.Printf(format, args...)
+	}
+}
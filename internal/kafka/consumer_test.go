@@ -0,0 +1,66 @@
+package kafka
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestConsumerHandle(t *testing.T) {
+	failing := errors.New("write failed")
+	tests := []struct {
+		name       string
+		retries    int
+		results    []error
+		cancel     bool
+		want       bool
+		wantCalls  int
+		wantGiveUp bool
+	}{
+		{"success", 3, []error{nil}, false, true, 1, false},
+		{"permanent error gives up right away", 3, []error{Permanent(failing)}, false, true, 1, true},
+		{"retries used up", 1, []error{failing, failing}, false, true, 2, true},
+		{"shutdown interrupts the retry wait", 3, []error{failing, failing}, true, false, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var gaveUp bool
+			c := &Consumer{retries: tt.retries, retryDelay: time.Millisecond, onGiveUp: func(context.Context, kafka.Message, error) { gaveUp = true }}
+			if tt.cancel {
+				// 关闭时不应该等完退避时间
+				c.retryDelay = time.Hour
+			}
+
+			calls := 0
+			handler := func(hctx context.Context, m kafka.Message) error {
+				if hctx.Err() != nil {
+					t.Error("handler context is cancelled")
+				}
+				err := tt.results[calls]
+				calls++
+				if tt.cancel {
+					cancel()
+				}
+				return err
+			}
+			start := time.Now()
+			if got := c.handle(ctx, kafka.Message{Topic: "news.raw"}, handler); got != tt.want {
+				t.Errorf("handle = %v, want %v", got, tt.want)
+			}
+			if time.Since(start) > 500*time.Millisecond {
+				t.Errorf("handle took %s", time.Since(start))
+			}
+			if calls != tt.wantCalls {
+				t.Errorf("handler called %d times, want %d", calls, tt.wantCalls)
+			}
+			if gaveUp != tt.wantGiveUp {
+				t.Errorf("gave up = %v, want %v", gaveUp, tt.wantGiveUp)
+			}
+		})
+	}
+}
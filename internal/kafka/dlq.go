@@ -0,0 +1,89 @@
+package kafka
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+// Headers added to messages published to a dead-letter topic.
+const (
+	HeaderDLQError     = "dlq.error"
+	HeaderDLQStage     = "dlq.stage"
+	HeaderDLQAttempts  = "dlq.attempts"
+	HeaderDLQFailedAt  = "dlq.failed_at"
+	HeaderDLQTopic     = "dlq.topic"
+	HeaderDLQPartition = "dlq.partition"
+	HeaderDLQOffset    = "dlq.offset"
+)
+
+// permanentError marks a failure that retrying cannot fix.
+type permanentError struct{ err error }
+
+func (e permanentError) Error() string { return e.err.Error() }
+func (e permanentError) Unwrap() error { return e.err }
+
+// Permanent marks err as a failure that retrying cannot fix, e.g. a message that cannot be
+// decoded or parsed: the consumer sends it to the dead-letter topic right away.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return permanentError{err: err}
+}
+
+// IsPermanent reports whether err was marked with Permanent.
+func IsPermanent(err error) bool {
+	var pe permanentError
+	return errors.As(err, &pe)
+}
+
+// DeadLetter returns the message to publish to a dead-letter topic for m, which failed in
+// stage after attempts attempts with err. It keeps the key, value and headers of m and
+// records where it came from, so it can be replayed to the original topic.
+func DeadLetter(m kafka.Message, stage string, attempts int, err error, now time.Time) kafka.Message {
+	headers := withoutDLQHeaders(m.Headers)
+	headers = append(headers,
+		kafka.Header{Key: HeaderDLQError, Value: []byte(err.Error())},
+		kafka.Header{Key: HeaderDLQStage, Value: []byte(stage)},
+		kafka.Header{Key: HeaderDLQAttempts, Value: []byte(strconv.Itoa(attempts))},
+		kafka.Header{Key: HeaderDLQFailedAt, Value: []byte(now.UTC().Format(time.RFC3339))},
+		kafka.Header{Key: HeaderDLQTopic, Value: []byte(m.Topic)},
+		kafka.Header{Key: HeaderDLQPartition, Value: []byte(strconv.Itoa(m.Partition))},
+		kafka.Header{Key: HeaderDLQOffset, Value: []byte(strconv.FormatInt(m.Offset, 10))},
+	)
+	return kafka.Message{Key: m.Key, Value: m.Value, Headers: headers}
+}
+
+// Replay returns the message to publish to the original topic for a dead-letter message d,
+// without the dead-letter headers. ok is false when d does not name its original topic.
+func Replay(d kafka.Message) (m kafka.Message, ok bool) {
+	topic := Header(d, HeaderDLQTopic)
+	if topic == "" {
+		return kafka.Message{}, false
+	}
+	return kafka.Message{Topic: topic, Key: d.Key, Value: d.Value, Headers: withoutDLQHeaders(d.Headers)}, true
+}
+
+// Header returns the value of the last header key of m, or "" if it is not set.
+func Header(m kafka.Message, key string) string {
+	for i := len(m.Headers) - 1; i >= 0; i-- {
+		if m.Headers[i].Key == key {
+			return string(m.Headers[i].Value)
+		}
+	}
+	return ""
+}
+
+func withoutDLQHeaders(headers []kafka.Header) []kafka.Header {
+	res := make([]kafka.Header, 0, len(headers)+7)
+	for _, h := range headers {
+		if !strings.HasPrefix(h.Key, "dlq.") {
+			res = append(res, h)
+		}
+	}
+	return res
+}
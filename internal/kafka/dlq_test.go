@@ -0,0 +1,93 @@
+package kafka
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestDeadLetterAndReplay(t *testing.T) {
+	now := time.Date(2024, 3, 5, 8, 0, 0, 0, time.FixedZone("CST", 8*3600))
+	orig := kafka.Message{
+		Topic:     "news.raw",
+		Partition: 3,
+		Offset:    42,
+		Key:       []byte("key"),
+		Value:     []byte(`{"url":"https://example.com/a"}`),
+		Headers:   []kafka.Header{{Key: "trace", Value: []byte("t1")}},
+	}
+
+	d := DeadLetter(orig, "parsed-producer", 4, errors.New("parse failed"), now)
+	if string(d.Key) != "key" || string(d.Value) != string(orig.Value) {
+		t.Fatalf("dead letter lost key or value: %+v", d)
+	}
+	wantHeaders := map[string]string{
+		"trace":            "t1",
+		HeaderDLQError:     "parse failed",
+		HeaderDLQStage:     "parsed-producer",
+		HeaderDLQAttempts:  "4",
+		HeaderDLQFailedAt:  "2024-03-05T00:00:00Z",
+		HeaderDLQTopic:     "news.raw",
+		HeaderDLQPartition: "3",
+		HeaderDLQOffset:    "42",
+	}
+	for k, want := range wantHeaders {
+		if got := Header(d, k); got != want {
+			t.Errorf("header %s = %q, want %q", k, got, want)
+		}
+	}
+
+	// 重放后再次失败时，死信头不会重复叠加
+	again := DeadLetter(kafka.Message{Topic: "news.raw", Partition: 1, Offset: 7, Headers: d.Headers}, "parsed-producer", 1, errors.New("again"), now)
+	count := 0
+	for _, h := range again.Headers {
+		if h.Key == HeaderDLQError {
+			count++
+		}
+	}
+	if count != 1 || Header(again, HeaderDLQOffset) != "7" {
+		t.Errorf("dead letter of a replayed message has headers %v", again.Headers)
+	}
+
+	r, ok := Replay(d)
+	if !ok {
+		t.Fatal("Replay rejected a dead letter")
+	}
+	if r.Topic != "news.raw" || string(r.Key) != "key" || string(r.Value) != string(orig.Value) {
+		t.Errorf("replayed message = %+v", r)
+	}
+	if len(r.Headers) != 1 || r.Headers[0].Key != "trace" {
+		t.Errorf("replayed headers = %v, want only the original ones", r.Headers)
+	}
+
+	if _, ok := Replay(kafka.Message{Value: []byte("x")}); ok {
+		t.Error("Replay accepted a message without dlq.topic")
+	}
+}
+
+func TestPermanent(t *testing.T) {
+	base := errors.New("decode")
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{base, false},
+		{Permanent(base), true},
+		{fmt.Errorf("wrapped: %w", Permanent(base)), true},
+	}
+	for _, tt := range tests {
+		if got := IsPermanent(tt.err); got != tt.want {
+			t.Errorf("IsPermanent(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+	if Permanent(nil) != nil {
+		t.Error("Permanent(nil) != nil")
+	}
+	if !errors.Is(Permanent(base), base) {
+		t.Error("Permanent hides the wrapped error")
+	}
+}
@@ -2,34 +2,131 @@ package kafka
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
 	"recommand/internal/config"
 
 	"github.com/segmentio/kafka-go"
 )
 
+// DeliveryFunc is called with every batch of messages an async writer finished: err is nil
+// when the batch was delivered and the delivery error otherwise.
+type DeliveryFunc func(topic string, msgs []kafka.Message, err error)
+
 type Writer struct {
 	Raw    *kafka.Writer
 	Parsed *kafka.Writer
+	async  bool
+}
+
+// NewWriter creates the writers of news.raw and news.parsed. Messages are partitioned by
+// key, so messages with the same key keep their order. With KAFKA_ASYNC the Write methods
+// return before delivery and the outcome of every batch is reported to onDelivery (which
+// may be nil); Close waits for the pending batches and their callbacks.
+func NewWriter(cfg config.KafkaConfig, onDelivery DeliveryFunc) (*Writer, error) {
+	transport, err := Transport(cfg)
+	if err != nil {
+		return nil, err
+	}
+	wRaw, err := newTopicWriter(cfg, transport, cfg.TopicRaw, onDelivery)
+	if err != nil {
+		return nil, err
+	}
+	wParsed, err := newTopicWriter(cfg, transport, cfg.TopicParsed, onDelivery)
+	if err != nil {
+		return nil, err
+	}
+	return &Writer{Raw: wRaw, Parsed: wParsed, async: cfg.Async}, nil
+}
+
+func newTopicWriter(cfg config.KafkaConfig, transport *kafka.Transport, topic string, onDelivery DeliveryFunc) (*kafka.Writer, error) {
+	compression, err := parseCompression(cfg.Compression)
+	if err != nil {
+		return nil, err
+	}
+	acks, err := parseRequiredAcks(cfg.RequiredAcks)
+	if err != nil {
+		return nil, err
+	}
+	w := &kafka.Writer{
+		Addr:         kafka.TCP(cfg.Brokers...),
+		Topic:        topic,
+		Balancer:     &kafka.Hash{},
+		BatchSize:    cfg.BatchSize,
+		BatchBytes:   cfg.BatchBytes,
+		BatchTimeout: cfg.Linger,
+		Compression:  compression,
+		RequiredAcks: acks,
+		Async:        cfg.Async,
+		Transport:    transport,
+	}
+	if cfg.Async && onDelivery != nil {
+		w.Completion = func(msgs []kafka.Message, err error) {
+			onDelivery(topic, msgs, err)
+		}
+	}
+	return w, nil
+}
+
+func parseCompression(s string) (kafka.Compression, error) {
+	switch strings.ToLower(s) {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	}
+	return 0, fmt.Errorf("unknown KAFKA_COMPRESSION %q (none, gzip, snappy, lz4, zstd)", s)
 }
 
-func NewWriter(cfg config.KafkaConfig) (*Writer, error) {
-	wRaw := &kafka.Writer{
-		Addr:     kafka.TCP(cfg.Brokers...),
-		Topic:    cfg.TopicRaw,
-		Balancer: &kafka.LeastBytes{},
+func parseRequiredAcks(s string) (kafka.RequiredAcks, error) {
+	switch strings.ToLower(s) {
+	case "none", "0":
+		return kafka.RequireNone, nil
+	case "one", "1":
+		return kafka.RequireOne, nil
+	case "", "all", "-1":
+		return kafka.RequireAll, nil
 	}
-	wParsed := &kafka.Writer{
-		Addr:     kafka.TCP(cfg.Brokers...),
-		Topic:    cfg.TopicParsed,
-		Balancer: &kafka.LeastBytes{},
+	return 0, fmt.Errorf("unknown KAFKA_REQUIRED_ACKS %q (none, one, all)", s)
+}
+
+// Key returns the message key of an article: the hex SHA-256 of its URL with lowercased
+// scheme and host and without fragment, so all messages of one article land in the same
+// partition.
+func Key(rawURL string) []byte {
+	norm := rawURL
+	if u, err := url.Parse(rawURL); err == nil {
+		u.Scheme = strings.ToLower(u.Scheme)
+		u.Host = strings.ToLower(u.Host)
+		u.Fragment = ""
+		u.RawFragment = ""
+		norm = u.String()
 	}
-	return &Writer{Raw: wRaw, Parsed: wParsed}, nil
+	sum := sha256.Sum256([]byte(norm))
+	return []byte(hex.EncodeToString(sum[:]))
+}
+
+// Async reports whether writes return before delivery (KAFKA_ASYNC).
+func (w *Writer) Async() bool {
+	return w != nil && w.async
 }
 
 func (w *Writer) Close() error {
 	if w == nil {
 		return nil
 	}
+	// Close 会先发送缓冲中的消息（异步模式下也一样）
 	if err := w.Raw.Close(); err != nil {
 		return err
 	}
@@ -39,18 +136,18 @@ func (w *Writer) Close() error {
 	return nil
 }
 
-// WriteRaw writes a single message value to the raw topic.
-func (w *Writer) WriteRaw(ctx context.Context, value []byte) error {
+// WriteRaw writes a message to the raw topic.
+func (w *Writer) WriteRaw(ctx context.Context, key, value []byte) error {
 	if w == nil || w.Raw == nil {
 		return nil
 	}
-	return w.Raw.WriteMessages(ctx, kafka.Message{Value: value})
+	return w.Raw.WriteMessages(ctx, kafka.Message{Key: key, Value: value, Time: time.Now()})
 }
 
-// WriteParsed writes a single message value to the parsed topic.
-func (w *Writer) WriteParsed(ctx context.Context, value []byte) error {
+// WriteParsed writes a message to the parsed topic.
+func (w *Writer) WriteParsed(ctx context.Context, key, value []byte) error {
 	if w == nil || w.Parsed == nil {
 		return nil
 	}
-	return w.Parsed.WriteMessages(ctx, kafka.Message{Value: value})
+	return w.Parsed.WriteMessages(ctx, kafka.Message{Key: key, Value: value, Time: time.Now()})
 }
@@ -0,0 +1,76 @@
+package kafka
+
+import (
+	"testing"
+
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKey(t *testing.T) {
+	const base = "https://news.example.com/a/1.html?id=2"
+	tests := []struct {
+		url  string
+		same bool
+	}{
+		{base, true},
+		{"HTTPS://News.Example.COM/a/1.html?id=2", true},
+		{base + "#comments", true},
+		{"https://news.example.com/A/1.html?id=2", false},
+		{"https://news.example.com/a/1.html?id=3", false},
+		{"http://news.example.com/a/1.html?id=2", false},
+	}
+	want := string(Key(base))
+	if len(want) != 64 {
+		t.Fatalf("Key(%q) = %q, want 64 hex characters", base, want)
+	}
+	for _, tt := range tests {
+		if got := string(Key(tt.url)) == want; got != tt.same {
+			t.Errorf("Key(%q) == Key(%q) is %v, want %v", tt.url, base, got, tt.same)
+		}
+	}
+}
+
+func TestParseCompression(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    kafka.Compression
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"none", 0, false},
+		{"GZIP", kafka.Gzip, false},
+		{"snappy", kafka.Snappy, false},
+		{"lz4", kafka.Lz4, false},
+		{"zstd", kafka.Zstd, false},
+		{"brotli", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseCompression(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseCompression(%q) = %v, %v; want %v, err %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestParseRequiredAcks(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    kafka.RequiredAcks
+		wantErr bool
+	}{
+		{"", kafka.RequireAll, false},
+		{"all", kafka.RequireAll, false},
+		{"-1", kafka.RequireAll, false},
+		{"One", kafka.RequireOne, false},
+		{"1", kafka.RequireOne, false},
+		{"none", kafka.RequireNone, false},
+		{"0", kafka.RequireNone, false},
+		{"2", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRequiredAcks(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("parseRequiredAcks(%q) = %v, %v; want %v, err %v", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
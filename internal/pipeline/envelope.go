@@ -0,0 +1,65 @@
+// Package pipeline defines the messages exchanged over the Kafka topics of the news
+// pipeline (news.raw, news.parsed) and their versioning rules.
+//
+// Every message carries an Envelope next to its payload fields, at the top level of the
+// JSON object. Consumers that do not know the envelope simply ignore its fields, and
+// messages written before the envelope existed decode with SchemaVersion 0, which counts
+// as version 1. A version is only raised for additive changes; consumers accept every
+// version from the oldest one they still support up to the one they were built with, so
+// consumers have to be rolled out before the producers of a new version.
+package pipeline
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrUnsupportedVersion is returned when a message has a schema version the consumer cannot handle.
+var ErrUnsupportedVersion = errors.New("unsupported schema version")
+
+// Envelope is the metadata of a pipeline message.
+type Envelope struct {
+	// MessageID identifies this message; it is new for every message written.
+	MessageID     string `json:"message_id,omitempty"`
+	SchemaVersion int    `json:"schema_version,omitempty"`
+	// Producer is the service that wrote the message, e.g. "crawler-service".
+	Producer string `json:"producer,omitempty"`
+	// TraceID follows one article through all pipeline stages: it is created with the
+	// news.raw message and copied into the news.parsed message derived from it.
+	TraceID    string    `json:"trace_id,omitempty"`
+	ProducedAt time.Time `json:"produced_at"`
+}
+
+// NewEnvelope returns the envelope of a new message. An empty traceID starts a new trace.
+func NewEnvelope(version int, producer, traceID string) Envelope {
+	if traceID == "" {
+		traceID = uuid.NewString()
+	}
+	return Envelope{
+		MessageID:     uuid.NewString(),
+		SchemaVersion: version,
+		Producer:      producer,
+		TraceID:       traceID,
+		ProducedAt:    time.Now().UTC(),
+	}
+}
+
+// Version returns the schema version of the message; messages without envelope are version 1.
+func (e Envelope) Version() int {
+	if e.SchemaVersion == 0 {
+		return 1
+	}
+	return e.SchemaVersion
+}
+
+// Check returns ErrUnsupportedVersion unless the message version is between minVersion and
+// maxVersion.
+func (e Envelope) Check(minVersion, maxVersion int) error {
+	if v := e.Version(); v < minVersion || v > maxVersion {
+		return fmt.Errorf("%w %d (supported %d-%d, producer %q)", ErrUnsupportedVersion, v, minVersion, maxVersion, e.Producer)
+	}
+	return nil
+}
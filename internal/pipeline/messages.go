@@ -0,0 +1,101 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"recommand/internal/blob"
+)
+
+// Schema versions of the pipeline topics. Version 1 are the messages without envelope.
+const (
+	// RawVersion 2 adds the envelope to news.raw.
+	RawVersion    = 2
+	MinRawVersion = 1
+	// ParsedVersion 2 adds the envelope to news.parsed.
+	ParsedVersion    = 2
+	MinParsedVersion = 1
+)
+
+// RawMessage is written by crawler-service into news.raw for every fetched article page.
+// Body is always UTF-8; Charset records the encoding the page was served in. The full page
+// body is carried as Body (plain or gzip+base64 per BodyEncoding), or stored in the blob
+// store and referenced by BodyRef.
+type RawMessage struct {
+	Envelope
+	TaskID       string `json:"task_id"`
+	SourceID     int64  `json:"source_id"`
+	SourceCode   string `json:"source_code"`
+	URL          string `json:"url"`
+	ListURL      string `json:"list_url"`
+	StatusCode   int    `json:"status_code"`
+	Charset      string `json:"charset"`
+	Body         string `json:"body,omitempty"`
+	BodyEncoding string `json:"body_encoding,omitempty"`
+	BodyRef      string `json:"body_ref,omitempty"`
+	BodySize     int    `json:"body_size"`
+	// BodySnippet is the truncated body sent by older crawler versions.
+	BodySnippet string `json:"body_snippet,omitempty"`
+}
+
+// HTML returns the complete page body of the message.
+func (m *RawMessage) HTML(ctx context.Context, store blob.Store) (string, error) {
+	if m.Body == "" && m.BodyRef == "" {
+		return m.BodySnippet, nil
+	}
+	b, err := blob.Unpack(ctx, blob.Packed{Body: m.Body, Encoding: m.BodyEncoding, Ref: m.BodyRef, Size: m.BodySize}, store)
+	if err != nil {
+		return "", err
+	}
+	return string(b), nil
+}
+
+// DecodeRaw decodes a news.raw message and checks that its version is supported.
+func DecodeRaw(b []byte) (*RawMessage, error) {
+	var m RawMessage
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Check(MinRawVersion, RawVersion); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// ParsedNews is the structured article parsed-producer writes into news.parsed.
+type ParsedNews struct {
+	Envelope
+	// ID is the id of the news row.
+	ID           string    `json:"id"`
+	TaskID       string    `json:"task_id"`
+	SourceID     int64     `json:"source_id"`
+	SourceCode   string    `json:"source_code"`
+	URL          string    `json:"url"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	Author       string    `json:"author"`
+	Editor       string    `json:"editor"`
+	OriginSource string    `json:"origin_source"`
+	Summary      string    `json:"summary"`
+	CanonicalURL string    `json:"canonical_url"`
+	LeadImage    string    `json:"lead_image"`
+	Images       []string  `json:"images"`
+	Tags         []string  `json:"tags"`
+	Language     string    `json:"language"`
+	PublishTime  time.Time `json:"publish_time"`
+	CrawlTime    time.Time `json:"crawl_time"`
+	Hash         string    `json:"hash"`
+}
+
+// DecodeParsed decodes a news.parsed message and checks that its version is supported.
+func DecodeParsed(b []byte) (*ParsedNews, error) {
+	var m ParsedNews
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+	if err := m.Check(MinParsedVersion, ParsedVersion); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
@@ -0,0 +1,90 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestDecodeRaw(t *testing.T) {
+	tests := []struct {
+		name        string
+		in          string
+		wantVersion int
+		wantErr     error
+	}{
+		{"legacy message without envelope", `{"task_id":"t1","url":"https://example.com/a","body_snippet":"<p>x</p>"}`, 1, nil},
+		{"current version", `{"schema_version":2,"trace_id":"tr","url":"https://example.com/a"}`, 2, nil},
+		{"newer version", `{"schema_version":3,"producer":"crawler-service","url":"https://example.com/a"}`, 0, ErrUnsupportedVersion},
+		{"negative version", `{"schema_version":-1}`, 0, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m, err := DecodeRaw([]byte(tt.in))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("DecodeRaw err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && m.Version() != tt.wantVersion {
+				t.Errorf("Version() = %d, want %d", m.Version(), tt.wantVersion)
+			}
+		})
+	}
+
+	if _, err := DecodeRaw([]byte(`{"url":`)); err == nil {
+		t.Error("DecodeRaw accepted invalid JSON")
+	}
+}
+
+func TestDecodeParsed(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		wantErr error
+	}{
+		{"legacy message without envelope", `{"id":"t1::https://example.com/a","hash":"h"}`, nil},
+		{"current version", `{"schema_version":2,"id":"x"}`, nil},
+		{"newer version", `{"schema_version":3,"id":"x"}`, ErrUnsupportedVersion},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeParsed([]byte(tt.in)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("DecodeParsed err = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestEnvelopeRoundTrip(t *testing.T) {
+	raw := RawMessage{Envelope: NewEnvelope(RawVersion, "crawler-service", ""), TaskID: "t1", URL: "https://example.com/a"}
+	if raw.TraceID == "" || raw.MessageID == "" {
+		t.Fatalf("NewEnvelope did not start a trace: %+v", raw.Envelope)
+	}
+	b, err := json.Marshal(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := DecodeRaw(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.TraceID != raw.TraceID || got.MessageID != raw.MessageID || got.Producer != "crawler-service" || got.Version() != RawVersion {
+		t.Errorf("decoded envelope = %+v, want %+v", got.Envelope, raw.Envelope)
+	}
+
+	// news.parsed 沿用 news.raw 的 trace id，但 message id 是新的
+	parsed := ParsedNews{Envelope: NewEnvelope(ParsedVersion, "parsed-producer", got.TraceID), ID: "t1::https://example.com/a"}
+	b, err = json.Marshal(parsed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := DecodeParsed(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TraceID != raw.TraceID {
+		t.Errorf("parsed trace id = %q, want %q", p.TraceID, raw.TraceID)
+	}
+	if p.MessageID == raw.MessageID {
+		t.Error("parsed message reuses the message id of the raw message")
+	}
+}
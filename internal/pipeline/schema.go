@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Topic describes the messages of one pipeline topic.
+type Topic struct {
+	Name    string
+	Version int
+	Message any
+}
+
+// Topics lists the pipeline topics by their default name.
+var Topics = []Topic{
+	{Name: "news.raw", Version: RawVersion, Message: RawMessage{}},
+	{Name: "news.parsed", Version: ParsedVersion, Message: ParsedNews{}},
+}
+
+// JSONSchema returns the JSON Schema (draft 2020-12) of the messages of t, derived from the
+// json tags of its Go type. Fields without omitempty are required.
+func JSONSchema(t Topic) ([]byte, error) {
+	s := schemaOf(reflect.TypeOf(t.Message))
+	s["$schema"] = "https://json-schema.org/draft/2020-12/schema"
+	s["$id"] = t.Name + ".v" + strconv.Itoa(t.Version) + ".json"
+	s["title"] = t.Name
+	s["x-schema-version"] = t.Version
+	return json.MarshalIndent(s, "", "  ")
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func schemaOf(t reflect.Type) map[string]any {
+	if t == timeType {
+		return map[string]any{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return schemaOf(t.Elem())
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": []string{"array", "null"}, "items": schemaOf(t.Elem())}
+	case reflect.Struct:
+		props := map[string]any{}
+		var required []string
+		addFields(t, props, &required)
+		s := map[string]any{"type": "object", "properties": props}
+		if len(required) > 0 {
+			s["required"] = required
+		}
+		return s
+	}
+	return map[string]any{}
+}
+
+// addFields adds the JSON properties of struct t; fields of embedded structs are inlined,
+// as encoding/json does.
+func addFields(t reflect.Type, props map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			addFields(f.Type, props, required)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = schemaOf(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
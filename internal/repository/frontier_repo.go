@@ -0,0 +1,115 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"recommand/internal/domain"
+)
+
+const frontierColumns = `task_id, url, kind, depth, state, attempts, anchor, listed_at, list_url, last_error, failure_class, outcome, created_at, updated_at`
+
+// FrontierRepo stores the URL frontier of crawl tasks in crawl_frontier.
+type FrontierRepo struct {
+	db *sql.DB
+}
+
+func NewFrontierRepo(db *sql.DB) *FrontierRepo {
+	return &FrontierRepo{db: db}
+}
+
+// Add inserts entries of one kind and depth; URLs already in the task frontier are ignored.
+func (r *FrontierRepo) Add(ctx context.Context, taskID, kind string, depth int, listURL string, entries []domain.FrontierEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	urls := make([]string, len(entries))
+	states := make([]string, len(entries))
+	anchors := make([]string, len(entries))
+	listedAt := make([]sql.NullString, len(entries))
+	for i, e := range entries {
+		urls[i], states[i], anchors[i] = e.URL, e.State, e.Anchor
+		if e.ListedAt != nil {
+			listedAt[i] = sql.NullString{String: e.ListedAt.Format(time.RFC3339Nano), Valid: true}
+		}
+	}
+	_, err := r.db.ExecContext(ctx, `
+INSERT INTO crawl_frontier (task_id, url, kind, depth, state, anchor, listed_at, list_url)
+SELECT $1, t.url, $2, $3, t.state, t.anchor, t.listed_at::timestamptz, NULLIF($4, '')
+FROM unnest($5::text[], $6::text[], $7::text[], $8::text[]) AS t(url, state, anchor, listed_at)
+ON CONFLICT (task_id, url) DO NOTHING`,
+		taskID, kind, depth, listURL, pq.Array(urls), pq.Array(states), pq.Array(anchors), pq.Array(listedAt))
+	return err
+}
+
+// List returns the frontier of a task in discovery order.
+func (r *FrontierRepo) List(ctx context.Context, taskID string) ([]domain.FrontierEntry, error) {
+	rows, err := r.db.QueryContext(ctx, `SELECT `+frontierColumns+` FROM crawl_frontier WHERE task_id=$1 ORDER BY depth, created_at, url`, taskID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var res []domain.FrontierEntry
+	for rows.Next() {
+		var (
+			e       domain.FrontierEntry
+			anchor  sql.NullString
+			listURL sql.NullString
+		)
+		if err := rows.Scan(&e.TaskID, &e.URL, &e.Kind, &e.Depth, &e.State, &e.Attempts, &anchor, &e.ListedAt, &listURL, &e.LastError, &e.FailureClass, &e.Outcome, &e.CreatedAt, &e.UpdatedAt); err != nil {
+			return nil, err
+		}
+		e.Anchor, e.ListURL = anchor.String, listURL.String
+		res = append(res, e)
+	}
+	return res, rows.Err()
+}
+
+// MarkFetching moves an entry into fetching state and counts the attempt.
+func (r *FrontierRepo) MarkFetching(ctx context.Context, taskID, url string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_frontier SET state=$1, attempts=attempts+1, updated_at=NOW() WHERE task_id=$2 AND url=$3`, domain.FrontierFetching, taskID, url)
+	return err
+}
+
+// MarkState records the outcome of an entry; errMsg is stored into last_error when not nil.
+func (r *FrontierRepo) MarkState(ctx context.Context, taskID, url, state string, errMsg *string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_frontier SET state=$1, last_error=COALESCE($2, last_error), updated_at=NOW() WHERE task_id=$3 AND url=$4`, state, errMsg, taskID, url)
+	return err
+}
+
+// MarkFailed records a failed entry with the class and message of its failure.
+func (r *FrontierRepo) MarkFailed(ctx context.Context, taskID, url, class, errMsg string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_frontier SET state=$1, failure_class=$2, last_error=$3, updated_at=NOW() WHERE task_id=$4 AND url=$5`, domain.FrontierFailed, class, errMsg, taskID, url)
+	return err
+}
+
+// RecordOutcome records the downstream outcome of a fetched article and counts it in the
+// task: saved into articles_saved, duplicate into duplicates_skipped, anything else into
+// errors. Only the first outcome of an entry counts, so replayed messages are not counted
+// twice. It reports false when the entry is unknown or already had an outcome.
+func (r *FrontierRepo) RecordOutcome(ctx context.Context, taskID, url, outcome string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `
+WITH o AS (
+	UPDATE crawl_frontier SET outcome=$3, updated_at=NOW()
+	WHERE task_id=$1 AND url=$2 AND outcome IS NULL
+	RETURNING 1
+)
+UPDATE crawl_tasks SET
+	articles_saved=articles_saved + CASE WHEN $3='`+domain.OutcomeSaved+`' THEN 1 ELSE 0 END,
+	duplicates_skipped=duplicates_skipped + CASE WHEN $3='`+domain.OutcomeDuplicate+`' THEN 1 ELSE 0 END,
+	errors=errors + CASE WHEN $3 IN ('`+domain.OutcomeSaved+`', '`+domain.OutcomeDuplicate+`') THEN 0 ELSE 1 END,
+	updated_at=NOW()
+WHERE task_id=$1 AND EXISTS (SELECT 1 FROM o)`, taskID, url, outcome)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+)
+
+// HTTPCacheRepo stores the HTTP validators (ETag, Last-Modified) of fetched URLs in http_cache.
+type HTTPCacheRepo struct {
+	db *sql.DB
+}
+
+func NewHTTPCacheRepo(db *sql.DB) *HTTPCacheRepo {
+	return &HTTPCacheRepo{db: db}
+}
+
+// Get returns the validators stored for url; both are empty when the URL is unknown.
+func (r *HTTPCacheRepo) Get(ctx context.Context, url string) (etag, lastModified string, err error) {
+	var e, lm sql.NullString
+	err = r.db.QueryRowContext(ctx, `SELECT etag, last_modified FROM http_cache WHERE url=$1`, url).Scan(&e, &lm)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return "", "", nil
+		}
+		return "", "", err
+	}
+	return e.String, lm.String, nil
+}
+
+// Put stores the validators of url.
+func (r *HTTPCacheRepo) Put(ctx context.Context, url, etag, lastModified string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO http_cache (url, etag, last_modified, updated_at) VALUES ($1, NULLIF($2, ''), NULLIF($3, ''), NOW())
+ON CONFLICT (url) DO UPDATE SET etag=EXCLUDED.etag, last_modified=EXCLUDED.last_modified, updated_at=NOW()`, url, etag, lastModified)
+	return err
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+type NewsRepo struct {
+	db *sql.DB
+}
+
+func NewNewsRepo(db *sql.DB) *NewsRepo {
+	return &NewsRepo{db: db}
+}
+
+// ExistingURLs returns the subset of urls that are already stored in news.
+func (r *NewsRepo) ExistingURLs(ctx context.Context, urls []string) (map[string]bool, error) {
+	res := make(map[string]bool)
+	if len(urls) == 0 {
+		return res, nil
+	}
+	rows, err := r.db.QueryContext(ctx, `SELECT DISTINCT url FROM news WHERE url = ANY($1)`, pq.Array(urls))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var u string
+		if err := rows.Scan(&u); err != nil {
+			return nil, err
+		}
+		res[u] = true
+	}
+	return res, rows.Err()
+}
@@ -3,10 +3,50 @@ package repository
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"time"
 
 	"recommand/internal/domain"
 )
 
+const sourceColumns = `id, name, code, base_url, language, category, enabled, crawl_interval_minutes, max_concurrency, last_crawl_at, last_crawl_status, created_at, updated_at, extraction_rules, discovery`
+
+func scanSource(row rowScanner) (*domain.NewsSource, error) {
+	var (
+		ns        domain.NewsSource
+		rules     []byte
+		discovery []byte
+	)
+	if err := row.Scan(&ns.ID, &ns.Name, &ns.Code, &ns.BaseURL, &ns.Language, &ns.Category, &ns.Enabled, &ns.CrawlIntervalMin, &ns.MaxConcurrency, &ns.LastCrawlAt, &ns.LastCrawlStatus, &ns.CreatedAt, &ns.UpdatedAt, &rules, &discovery); err != nil {
+		return nil, err
+	}
+	if len(rules) > 0 {
+		ns.ExtractionRules = &domain.ExtractionRules{}
+		if err := json.Unmarshal(rules, ns.ExtractionRules); err != nil {
+			return nil, err
+		}
+	}
+	if len(discovery) > 0 {
+		ns.Discovery = &domain.Discovery{}
+		if err := json.Unmarshal(discovery, ns.Discovery); err != nil {
+			return nil, err
+		}
+	}
+	return &ns, nil
+}
+
+// jsonValue encodes v for a JSONB column; nil pointers are stored as NULL.
+func jsonValue[T any](v *T) (any, error) {
+	if v == nil {
+		return nil, nil
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(b), nil
+}
+
 type SourceRepo struct {
 	db *sql.DB
 }
@@ -16,7 +56,7 @@ func NewSourceRepo(db *sql.DB) *SourceRepo {
 }
 
 func (r *SourceRepo) List(ctx context.Context) ([]domain.NewsSource, error) {
-	rows, err := r.db.QueryContext(ctx, `SELECT id, name, code, base_url, language, category, enabled, crawl_interval_minutes, max_concurrency, last_crawl_at, last_crawl_status, created_at, updated_at FROM news_sources ORDER BY id`)
+	rows, err := r.db.QueryContext(ctx, `SELECT `+sourceColumns+` FROM news_sources ORDER BY id`)
 	if err != nil {
 		return nil, err
 	}
@@ -24,34 +64,50 @@ func (r *SourceRepo) List(ctx context.Context) ([]domain.NewsSource, error) {
 
 	var res []domain.NewsSource
 	for rows.Next() {
-		var ns domain.NewsSource
-		if err := rows.Scan(&ns.ID, &ns.Name, &ns.Code, &ns.BaseURL, &ns.Language, &ns.Category, &ns.Enabled, &ns.CrawlIntervalMin, &ns.MaxConcurrency, &ns.LastCrawlAt, &ns.LastCrawlStatus, &ns.CreatedAt, &ns.UpdatedAt); err != nil {
+		ns, err := scanSource(rows)
+		if err != nil {
 			return nil, err
 		}
-		res = append(res, ns)
+		res = append(res, *ns)
 	}
 	return res, rows.Err()
 }
 
 func (r *SourceRepo) GetByID(ctx context.Context, id int64) (*domain.NewsSource, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT id, name, code, base_url, language, category, enabled, crawl_interval_minutes, max_concurrency, last_crawl_at, last_crawl_status, created_at, updated_at FROM news_sources WHERE id=$1`, id)
-	var ns domain.NewsSource
-	if err := row.Scan(&ns.ID, &ns.Name, &ns.Code, &ns.BaseURL, &ns.Language, &ns.Category, &ns.Enabled, &ns.CrawlIntervalMin, &ns.MaxConcurrency, &ns.LastCrawlAt, &ns.LastCrawlStatus, &ns.CreatedAt, &ns.UpdatedAt); err != nil {
+	row := r.db.QueryRowContext(ctx, `SELECT `+sourceColumns+` FROM news_sources WHERE id=$1`, id)
+	ns, err := scanSource(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &ns, nil
+	return ns, nil
 }
 
 func (r *SourceRepo) Create(ctx context.Context, ns *domain.NewsSource) error {
-	row := r.db.QueryRowContext(ctx, `INSERT INTO news_sources (name, code, base_url, language, category, enabled, crawl_interval_minutes, max_concurrency) VALUES ($1,$2,$3,$4,$5,$6,$7,$8) RETURNING id, created_at, updated_at`, ns.Name, ns.Code, ns.BaseURL, ns.Language, ns.Category, ns.Enabled, ns.CrawlIntervalMin, ns.MaxConcurrency)
+	rules, err := jsonValue(ns.ExtractionRules)
+	if err != nil {
+		return err
+	}
+	discovery, err := jsonValue(ns.Discovery)
+	if err != nil {
+		return err
+	}
+	row := r.db.QueryRowContext(ctx, `INSERT INTO news_sources (name, code, base_url, language, category, enabled, crawl_interval_minutes, max_concurrency, extraction_rules, discovery) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10) RETURNING id, created_at, updated_at`, ns.Name, ns.Code, ns.BaseURL, ns.Language, ns.Category, ns.Enabled, ns.CrawlIntervalMin, ns.MaxConcurrency, rules, discovery)
 	return row.Scan(&ns.ID, &ns.CreatedAt, &ns.UpdatedAt)
 }
 
 func (r *SourceRepo) Update(ctx context.Context, ns *domain.NewsSource) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE news_sources SET name=$1, code=$2, base_url=$3, language=$4, category=$5, enabled=$6, crawl_interval_minutes=$7, max_concurrency=$8, updated_at=NOW() WHERE id=$9`, ns.Name, ns.Code, ns.BaseURL, ns.Language, ns.Category, ns.Enabled, ns.CrawlIntervalMin, ns.MaxConcurrency, ns.ID)
+	rules, err := jsonValue(ns.ExtractionRules)
+	if err != nil {
+		return err
+	}
+	discovery, err := jsonValue(ns.Discovery)
+	if err != nil {
+		return err
+	}
+	_, err = r.db.ExecContext(ctx, `UPDATE news_sources SET name=$1, code=$2, base_url=$3, language=$4, category=$5, enabled=$6, crawl_interval_minutes=$7, max_concurrency=$8, extraction_rules=$9, discovery=$10, updated_at=NOW() WHERE id=$11`, ns.Name, ns.Code, ns.BaseURL, ns.Language, ns.Category, ns.Enabled, ns.CrawlIntervalMin, ns.MaxConcurrency, rules, discovery, ns.ID)
 	return err
 }
 
@@ -59,3 +115,9 @@ func (r *SourceRepo) UpdateEnabled(ctx context.Context, id int64, enabled bool)
 	_, err := r.db.ExecContext(ctx, `UPDATE news_sources SET enabled=$1, updated_at=NOW() WHERE id=$2`, enabled, id)
 	return err
 }
+
+// UpdateLastCrawl records when a source was last crawled and how that crawl ended.
+func (r *SourceRepo) UpdateLastCrawl(ctx context.Context, id int64, at time.Time, status string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE news_sources SET last_crawl_at=$1, last_crawl_status=$2, updated_at=NOW() WHERE id=$3`, at, status, id)
+	return err
+}
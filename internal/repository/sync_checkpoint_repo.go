@@ -0,0 +1,35 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// SyncCheckpointRepo stores how far es-sync has indexed news, one row per index in es_sync_checkpoint.
+type SyncCheckpointRepo struct {
+	db *sql.DB
+}
+
+func NewSyncCheckpointRepo(db *sql.DB) *SyncCheckpointRepo {
+	return &SyncCheckpointRepo{db: db}
+}
+
+// Get returns the (updated_at, id) of the last news row indexed into name; zero values when nothing was synced yet.
+func (r *SyncCheckpointRepo) Get(ctx context.Context, name string) (updatedAt time.Time, lastID string, err error) {
+	err = r.db.QueryRowContext(ctx, `SELECT updated_at, last_id FROM es_sync_checkpoint WHERE name=$1`, name).Scan(&updatedAt, &lastID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return time.Time{}, "", nil
+		}
+		return time.Time{}, "", err
+	}
+	return updatedAt, lastID, nil
+}
+
+// Save moves the checkpoint of name to (updatedAt, lastID).
+func (r *SyncCheckpointRepo) Save(ctx context.Context, name string, updatedAt time.Time, lastID string) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO es_sync_checkpoint (name, updated_at, last_id, synced_at) VALUES ($1, $2, $3, NOW())
+ON CONFLICT (name) DO UPDATE SET updated_at=EXCLUDED.updated_at, last_id=EXCLUDED.last_id, synced_at=NOW()`, name, updatedAt, lastID)
+	return err
+}
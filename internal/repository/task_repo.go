@@ -4,10 +4,34 @@ import (
 	"context"
 	"database/sql"
 	"strings"
+	"time"
 
 	"recommand/internal/domain"
 )
 
+// activeCond restricts updates to tasks that have not reached a final status yet,
+// so a stop recorded by the API can never be overwritten by the engine.
+const activeCond = `status IN ('pending', 'running')`
+
+// unsettledCond matches tasks with articles written into news.raw that no pipeline stage
+// has reported an outcome for yet. Articles still fetching after the crawl ended are
+// messages an async writer has not delivered yet.
+const unsettledCond = `EXISTS (SELECT 1 FROM crawl_frontier f WHERE f.task_id=crawl_tasks.task_id AND f.kind='` + domain.FrontierArticle + `' AND f.state IN ('` + domain.FrontierDone + `', '` + domain.FrontierFetching + `') AND f.outcome IS NULL)`
+
+const taskColumns = `task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by, created_at, updated_at, last_page_url, stop_reason, heartbeat_at, not_modified, bytes_fetched, stage, raw_messages`
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanTask(row rowScanner) (*domain.CrawlTask, error) {
+	var t domain.CrawlTask
+	if err := row.Scan(&t.TaskID, &t.SourceID, &t.SourceName, &t.Mode, &t.Since, &t.MaxPages, &t.Status, &t.Progress, &t.PagesCrawled, &t.ArticlesFound, &t.ArticlesSaved, &t.DuplicatesSkipped, &t.Errors, &t.StartedAt, &t.CompletedAt, &t.ErrorMessage, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt, &t.LastPageURL, &t.StopReason, &t.HeartbeatAt, &t.NotModified, &t.BytesFetched, &t.Stage, &t.RawMessages); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
 type TaskRepo struct {
 	db *sql.DB
 }
@@ -17,24 +41,24 @@ func NewTaskRepo(db *sql.DB) *TaskRepo {
 }
 
 func (r *TaskRepo) Create(ctx context.Context, t *domain.CrawlTask) error {
-	_, err := r.db.ExecContext(ctx, `INSERT INTO crawl_tasks (task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17)`, t.TaskID, t.SourceID, t.SourceName, t.Mode, t.Since, t.MaxPages, t.Status, t.Progress, t.PagesCrawled, t.ArticlesFound, t.ArticlesSaved, t.DuplicatesSkipped, t.Errors, t.StartedAt, t.CompletedAt, t.ErrorMessage, t.CreatedBy)
+	_, err := r.db.ExecContext(ctx, `INSERT INTO crawl_tasks (task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by, stage) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)`, t.TaskID, t.SourceID, t.SourceName, t.Mode, t.Since, t.MaxPages, t.Status, t.Progress, t.PagesCrawled, t.ArticlesFound, t.ArticlesSaved, t.DuplicatesSkipped, t.Errors, t.StartedAt, t.CompletedAt, t.ErrorMessage, t.CreatedBy, t.Stage)
 	return err
 }
 
 func (r *TaskRepo) GetByID(ctx context.Context, id string) (*domain.CrawlTask, error) {
-	row := r.db.QueryRowContext(ctx, `SELECT task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by, created_at, updated_at FROM crawl_tasks WHERE task_id=$1`, id)
-	var t domain.CrawlTask
-	if err := row.Scan(&t.TaskID, &t.SourceID, &t.SourceName, &t.Mode, &t.Since, &t.MaxPages, &t.Status, &t.Progress, &t.PagesCrawled, &t.ArticlesFound, &t.ArticlesSaved, &t.DuplicatesSkipped, &t.Errors, &t.StartedAt, &t.CompletedAt, &t.ErrorMessage, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+	row := r.db.QueryRowContext(ctx, `SELECT `+taskColumns+` FROM crawl_tasks WHERE task_id=$1`, id)
+	t, err := scanTask(row)
+	if err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil
 		}
 		return nil, err
 	}
-	return &t, nil
+	return t, nil
 }
 
 func (r *TaskRepo) List(ctx context.Context, sourceID *int64, status *domain.CrawlStatus) ([]domain.CrawlTask, error) {
-	query := `SELECT task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by, created_at, updated_at FROM crawl_tasks`
+	query := `SELECT ` + taskColumns + ` FROM crawl_tasks`
 	args := []any{}
 	conditions := []string{}
 	if sourceID != nil {
@@ -62,11 +86,11 @@ func (r *TaskRepo) List(ctx context.Context, sourceID *int64, status *domain.Cra
 
 	var res []domain.CrawlTask
 	for rows.Next() {
-		var t domain.CrawlTask
-		if err := rows.Scan(&t.TaskID, &t.SourceID, &t.SourceName, &t.Mode, &t.Since, &t.MaxPages, &t.Status, &t.Progress, &t.PagesCrawled, &t.ArticlesFound, &t.ArticlesSaved, &t.DuplicatesSkipped, &t.Errors, &t.StartedAt, &t.CompletedAt, &t.ErrorMessage, &t.CreatedBy, &t.CreatedAt, &t.UpdatedAt); err != nil {
+		t, err := scanTask(rows)
+		if err != nil {
 			return nil, err
 		}
-		res = append(res, t)
+		res = append(res, *t)
 	}
 	return res, rows.Err()
 }
@@ -77,7 +101,190 @@ func (r *TaskRepo) UpdateStatus(ctx context.Context, id string, status domain.Cr
 }
 
 // UpdateStatusAndProgress updates status, progress and pages_crawled for a task.
+// Tasks that already reached a final status (stopped/completed/failed) are left untouched.
 func (r *TaskRepo) UpdateStatusAndProgress(ctx context.Context, id string, status domain.CrawlStatus, progress float64, pages int) error {
-	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET status=$1, progress=$2, pages_crawled=$3, updated_at=NOW() WHERE task_id=$4`, status, progress, pages, id)
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET status=$1, progress=$2, pages_crawled=$3, updated_at=NOW() WHERE task_id=$4 AND `+activeCond, status, progress, pages, id)
+	return err
+}
+
+// MarkRunning moves a task into running state and stamps started_at on first start.
+func (r *TaskRepo) MarkRunning(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET status=$1, stage=$2, started_at=COALESCE(started_at, NOW()), heartbeat_at=NOW(), updated_at=NOW() WHERE task_id=$3 AND `+activeCond, domain.StatusRunning, domain.StageFetching, id)
+	return err
+}
+
+// Finish moves a task into a final status and stamps completed_at.
+// errMsg is stored into error_message when not nil.
+func (r *TaskRepo) Finish(ctx context.Context, id string, status domain.CrawlStatus, progress float64, pages int, errMsg *string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET status=$1, stage=$2, progress=$3, pages_crawled=$4, error_message=COALESCE($5, error_message), completed_at=NOW(), updated_at=NOW() WHERE task_id=$6 AND `+activeCond, status, domain.StageDone, progress, pages, errMsg, id)
+	return err
+}
+
+// MarkStopped stops a pending/running task and records the reason in error_message.
+// It reports false when the task does not exist or is already in a final status.
+func (r *TaskRepo) MarkStopped(ctx context.Context, id string, reason string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET status=$1, stage=$2, error_message=$3, completed_at=NOW(), updated_at=NOW() WHERE task_id=$4 AND `+activeCond, domain.StatusStopped, domain.StageDone, reason, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CreateIfIdle creates the task unless its source already has a pending or running task,
+// and reports whether it was created. Callers for the same source are serialized with an
+// advisory lock, so several schedulers never start two tasks for one source.
+func (r *TaskRepo) CreateIfIdle(ctx context.Context, t *domain.CrawlTask) (bool, error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, t.SourceID); err != nil {
+		return false, err
+	}
+	var active bool
+	if err := tx.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM crawl_tasks WHERE source_id=$1 AND `+activeCond+`)`, t.SourceID).Scan(&active); err != nil {
+		return false, err
+	}
+	if active {
+		return false, nil
+	}
+	if _, err := tx.ExecContext(ctx, `INSERT INTO crawl_tasks (task_id, source_id, source_name, mode, since, max_pages, status, progress, pages_crawled, articles_found, articles_saved, duplicates_skipped, errors, started_at, completed_at, error_message, created_by, stage) VALUES ($1,$2,$3,$4,$5,$6,$7,$8,$9,$10,$11,$12,$13,$14,$15,$16,$17,$18)`, t.TaskID, t.SourceID, t.SourceName, t.Mode, t.Since, t.MaxPages, t.Status, t.Progress, t.PagesCrawled, t.ArticlesFound, t.ArticlesSaved, t.DuplicatesSkipped, t.Errors, t.StartedAt, t.CompletedAt, t.ErrorMessage, t.CreatedBy, t.Stage); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// UpdatePosition records the last list page a task walked and why it stopped paging.
+// It is allowed on finished tasks too, so a stopped task still reports where it stopped.
+func (r *TaskRepo) UpdatePosition(ctx context.Context, id string, lastPageURL, stopReason string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET last_page_url=$1, stop_reason=NULLIF($2, ''), updated_at=NOW() WHERE task_id=$3`, lastPageURL, stopReason, id)
+	return err
+}
+
+// Heartbeat records that an engine is still running the task. It reports false when the
+// task is no longer pending or running, e.g. because it was stopped through another instance.
+func (r *TaskRepo) Heartbeat(ctx context.Context, id string) (bool, error) {
+	res, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET heartbeat_at=NOW() WHERE task_id=$1 AND `+activeCond, id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// ClaimOrphaned claims pending/running tasks whose heartbeat (or, for tasks that never
+// started, last update) is older than staleAfter, and returns their ids. Claiming refreshes
+// the heartbeat, so concurrent engines never adopt the same task.
+func (r *TaskRepo) ClaimOrphaned(ctx context.Context, staleAfter time.Duration) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `UPDATE crawl_tasks SET heartbeat_at=NOW(), updated_at=NOW() WHERE `+activeCond+` AND stage='`+string(domain.StageFetching)+`' AND COALESCE(heartbeat_at, updated_at) < NOW() - $1 * INTERVAL '1 second' RETURNING task_id`, staleAfter.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AddFetchStats adds to the not-modified and fetched-bytes counters of a task.
+func (r *TaskRepo) AddFetchStats(ctx context.Context, id string, notModified int, bytes int64) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET not_modified=not_modified+$1, bytes_fetched=bytes_fetched+$2, updated_at=NOW() WHERE task_id=$3`, notModified, bytes, id)
+	return err
+}
+
+// AwaitParse ends the fetching stage of a running task: it stays running in the
+// awaiting_parse stage until CompleteIfSettled or CompleteAwaiting completes it.
+func (r *TaskRepo) AwaitParse(ctx context.Context, id string, pages int, errMsg *string) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET stage=$1, progress=100, pages_crawled=$2, error_message=COALESCE($3, error_message), updated_at=NOW() WHERE task_id=$4 AND `+activeCond, domain.StageAwaitingParse, pages, errMsg, id)
+	return err
+}
+
+// recordLastCrawl is appended to a "done" CTE that returns the tasks just completed: for the
+// settled ones it records when they started fetching as the last successful crawl of their
+// sources, the lower bound of the next incremental crawl. Tasks still awaiting the parse
+// pipeline, and tasks that gave up waiting for it, do not count, so the next crawl does not
+// skip their unparsed pages.
+const recordLastCrawl = `, last_crawl AS (
+	UPDATE news_sources s SET last_crawl_at=COALESCE(d.started_at, d.created_at), last_crawl_status='` + string(domain.StatusCompleted) + `', updated_at=NOW()
+	FROM done d WHERE s.id=d.source_id AND d.settled
+)
+`
+
+// CompleteIfSettled completes a task in the awaiting_parse stage once every article it
+// wrote into news.raw has an outcome, and records it as the last crawl of its source.
+// It reports whether the task was completed.
+func (r *TaskRepo) CompleteIfSettled(ctx context.Context, id string) (bool, error) {
+	var n int
+	err := r.db.QueryRowContext(ctx, `
+WITH done AS (
+	UPDATE crawl_tasks SET status=$1, stage=$2, completed_at=NOW(), updated_at=NOW()
+	WHERE task_id=$3 AND stage=$4 AND `+activeCond+` AND NOT `+unsettledCond+`
+	RETURNING source_id, started_at, created_at, true AS settled
+)`+recordLastCrawl+`SELECT count(*) FROM done`,
+		domain.StatusCompleted, domain.StageDone, id, domain.StageAwaitingParse).Scan(&n)
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+// CompleteAwaiting completes the tasks in the awaiting_parse stage that are settled, or that
+// saw no pipeline progress for timeout (zero waits forever); the latter note the missing outcomes in error_message.
+// Settled tasks are recorded as the last crawl of their sources. It returns the ids of the completed tasks.
+func (r *TaskRepo) CompleteAwaiting(ctx context.Context, timeout time.Duration) ([]string, error) {
+	rows, err := r.db.QueryContext(ctx, `
+WITH done AS (
+	UPDATE crawl_tasks SET status=$1, stage=$2, completed_at=NOW(), updated_at=NOW(),
+		error_message=CASE WHEN `+unsettledCond+` THEN concat_ws('; ', error_message, 'gave up waiting for the parse pipeline') ELSE error_message END
+	WHERE stage=$3 AND `+activeCond+` AND (NOT `+unsettledCond+` OR ($4 > 0 AND updated_at < NOW() - $4 * INTERVAL '1 second'))
+	RETURNING task_id, source_id, started_at, created_at, NOT `+unsettledCond+` AS settled
+)`+recordLastCrawl+`SELECT task_id FROM done`, domain.StatusCompleted, domain.StageDone, domain.StageAwaitingParse, timeout.Seconds())
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
+
+// AddRawMessages increments the number of article pages a task wrote into news.raw.
+func (r *TaskRepo) AddRawMessages(ctx context.Context, id string, n int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET raw_messages=raw_messages+$1, updated_at=NOW() WHERE task_id=$2`, n, id)
+	return err
+}
+
+// AddArticlesFound increments the number of article URLs a task discovered.
+func (r *TaskRepo) AddArticlesFound(ctx context.Context, id string, n int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET articles_found=articles_found+$1, updated_at=NOW() WHERE task_id=$2`, n, id)
+	return err
+}
+
+// AddErrors increments the error counter of a task.
+func (r *TaskRepo) AddErrors(ctx context.Context, id string, n int) error {
+	_, err := r.db.ExecContext(ctx, `UPDATE crawl_tasks SET errors=errors+$1, updated_at=NOW() WHERE task_id=$2`, n, id)
 	return err
 }
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"time"
+
+	"github.com/google/uuid"
+
+	"recommand/internal/config"
+	"recommand/internal/crawler"
+	"recommand/internal/domain"
+	"recommand/internal/repository"
+)
+
+// Scheduler periodically creates incremental crawl tasks for enabled sources
+// whose crawl_interval_minutes is up since their last crawl.
+type Scheduler struct {
+	cfg        config.SchedulerConfig
+	sourceRepo *repository.SourceRepo
+	taskRepo   *repository.TaskRepo
+	engine     *crawler.Engine
+	logger     *log.Logger
+
+	startedAt time.Time
+	rnd       *rand.Rand
+	// jitter holds the random delay added to each source's next run, re-rolled after every run
+	jitter map[int64]time.Duration
+}
+
+func New(cfg config.SchedulerConfig, sourceRepo *repository.SourceRepo, taskRepo *repository.TaskRepo, engine *crawler.Engine, logger *log.Logger) *Scheduler {
+	return &Scheduler{
+		cfg:        cfg,
+		sourceRepo: sourceRepo,
+		taskRepo:   taskRepo,
+		engine:     engine,
+		logger:     logger,
+		rnd:        rand.New(rand.NewSource(time.Now().UnixNano())),
+		jitter:     make(map[int64]time.Duration),
+	}
+}
+
+// Run checks all sources once per tick until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	interval := s.cfg.TickInterval
+	if interval <= 0 {
+		interval = time.Minute
+	}
+	s.startedAt = time.Now().UTC()
+	s.logf("scheduler started, tick=%s max_jitter=%s", interval, s.cfg.MaxJitter)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		s.tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Scheduler) tick(ctx context.Context) {
+	sources, err := s.sourceRepo.List(ctx)
+	if err != nil {
+		s.logf("scheduler: list sources failed: %v", err)
+		return
+	}
+
+	now := time.Now().UTC()
+	for i := range sources {
+		src := &sources[i]
+		if !src.Enabled {
+			continue
+		}
+		if now.Before(s.nextRun(src)) {
+			continue
+		}
+
+		started, err := s.startTask(ctx, src)
+		if err != nil {
+			s.logf("scheduler: create task for source %d failed: %v", src.ID, err)
+			continue
+		}
+		if started {
+			delete(s.jitter, src.ID)
+		}
+	}
+}
+
+// nextRun returns when the source is due: one interval after its last crawl
+// (or the scheduler start for never crawled sources) plus a per-source jitter.
+func (s *Scheduler) nextRun(src *domain.NewsSource) time.Time {
+	base := s.startedAt
+	if src.LastCrawlAt != nil {
+		interval := time.Duration(src.CrawlIntervalMin) * time.Minute
+		if interval < time.Minute {
+			interval = time.Minute
+		}
+		base = src.LastCrawlAt.Add(interval)
+	}
+
+	j, ok := s.jitter[src.ID]
+	if !ok {
+		if s.cfg.MaxJitter > 0 {
+			j = time.Duration(s.rnd.Int63n(int64(s.cfg.MaxJitter)))
+		}
+		s.jitter[src.ID] = j
+	}
+	return base.Add(j)
+}
+
+// startTask creates and starts an incremental task for the source unless it already has a
+// pending or running one. The task leaves since empty: the engine crawls back to the source's
+// last successful crawl, so articles published after a failed or stopped crawl are not lost.
+func (s *Scheduler) startTask(ctx context.Context, src *domain.NewsSource) (bool, error) {
+	now := time.Now().UTC()
+	task := &domain.CrawlTask{
+		TaskID:     uuid.NewString(),
+		SourceID:   src.ID,
+		SourceName: src.Name,
+		Mode:       domain.CrawlModeIncremental,
+		Status:     domain.StatusPending,
+		Stage:      domain.StageFetching,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}
+	created, err := s.taskRepo.CreateIfIdle(ctx, task)
+	if err != nil || !created {
+		return false, err
+	}
+	s.logf("scheduler: started incremental task %s for source %s", task.TaskID, src.Code)
+	s.engine.StartTask(task.TaskID)
+	return true, nil
+}
+
+func (s *Scheduler) logf(format string, args ...any) {
+	if s.logger != nil {
+		s.logger.Printf(format, args...)
+	}
+}
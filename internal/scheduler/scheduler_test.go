@@ -0,0 +1,63 @@
+package scheduler
+
+import (
+	"math/rand"
+	"testing"
+	"time"
+
+	"recommand/internal/config"
+	"recommand/internal/domain"
+)
+
+func newTestScheduler(maxJitter time.Duration, startedAt time.Time) *Scheduler {
+	return &Scheduler{
+		cfg:       config.SchedulerConfig{MaxJitter: maxJitter},
+		startedAt: startedAt,
+		rnd:       rand.New(rand.NewSource(1)),
+		jitter:    make(map[int64]time.Duration),
+	}
+}
+
+func TestNextRun(t *testing.T) {
+	startedAt := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	last := startedAt.Add(-time.Hour)
+
+	tests := []struct {
+		name     string
+		interval int
+		last     *time.Time
+		want     time.Time
+	}{
+		{"never crawled", 30, nil, startedAt},
+		{"one interval after last crawl", 30, &last, last.Add(30 * time.Minute)},
+		{"interval below one minute", 0, &last, last.Add(time.Minute)},
+		{"negative interval", -5, &last, last.Add(time.Minute)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestScheduler(0, startedAt)
+			src := &domain.NewsSource{ID: 1, CrawlIntervalMin: tt.interval, LastCrawlAt: tt.last}
+			if got := s.nextRun(src); !got.Equal(tt.want) {
+				t.Errorf("nextRun = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextRunJitter(t *testing.T) {
+	startedAt := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	maxJitter := 5 * time.Minute
+	s := newTestScheduler(maxJitter, startedAt)
+
+	for id := int64(1); id <= 20; id++ {
+		src := &domain.NewsSource{ID: id}
+		first := s.nextRun(src)
+		if j := first.Sub(startedAt); j < 0 || j >= maxJitter {
+			t.Fatalf("source %d: jitter %s, want within [0, %s)", id, j, maxJitter)
+		}
+		// 同一来源在下次启动前每个 tick 都用同一个抖动，否则到期时间会来回跳
+		if again := s.nextRun(src); !again.Equal(first) {
+			t.Fatalf("source %d: nextRun changed from %s to %s before the source ran", id, first, again)
+		}
+	}
+}
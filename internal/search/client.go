@@ -0,0 +1,87 @@
+// Package search creates the Elasticsearch client shared by crawler-service and es-sync.
+package search
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/elastic/go-elasticsearch/v8"
+
+	"recommand/internal/config"
+)
+
+// NewClient creates an Elasticsearch client from cfg. Certificates are verified against the
+// system roots or ES_CA_FILE, or pinned with ES_CERT_FINGERPRINT; verification is only
+// skipped with the explicit ES_INSECURE_SKIP_VERIFY opt-in.
+func NewClient(cfg config.ESConfig) (*elasticsearch.Client, error) {
+	tc, err := TLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tc
+
+	esCfg := elasticsearch.Config{
+		Addresses: []string{cfg.Address},
+		Transport: transport,
+	}
+	// API key 优先于用户名密码
+	if cfg.APIKey != "" {
+		esCfg.APIKey = cfg.APIKey
+	} else {
+		esCfg.Username = cfg.Username
+		esCfg.Password = cfg.Password
+	}
+	return elasticsearch.NewClient(esCfg)
+}
+
+// TLSConfig returns the TLS settings of the Elasticsearch connections.
+func TLSConfig(cfg config.ESConfig) (*tls.Config, error) {
+	tc := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CAFile != "" {
+		pem, err := os.ReadFile(cfg.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("read ES_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("ES_CA_FILE %s contains no PEM certificates", cfg.CAFile)
+		}
+		tc.RootCAs = pool
+	}
+	if cfg.CertFile != "" || cfg.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.CertFile, cfg.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load ES_CLIENT_CERT_FILE/ES_CLIENT_KEY_FILE: %w", err)
+		}
+		tc.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CertFingerprint != "" {
+		fingerprint, err := hex.DecodeString(strings.ToLower(strings.ReplaceAll(cfg.CertFingerprint, ":", "")))
+		if err != nil || len(fingerprint) != sha256.Size {
+			return nil, fmt.Errorf("ES_CERT_FINGERPRINT must be a SHA-256 hex fingerprint")
+		}
+		// 指纹固定证书：跳过证书链校验，改为要求对端证书链中有一张证书的 SHA-256 与指纹一致
+		tc.InsecureSkipVerify = true
+		tc.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+			for _, raw := range rawCerts {
+				digest := sha256.Sum256(raw)
+				if bytes.Equal(digest[:], fingerprint) {
+					return nil
+				}
+			}
+			return errors.New("elasticsearch certificate does not match ES_CERT_FINGERPRINT")
+		}
+		return tc, nil
+	}
+	tc.InsecureSkipVerify = cfg.InsecureSkipVerify
+	return tc, nil
+}